@@ -151,6 +151,29 @@ func yaml_emitter_set_indent(emitter *yaml_emitter_t, indent int) {
 	emitter.best_indent = indent
 }
 
+// Set whether block sequences are indented in block mappings.
+func yaml_emitter_set_indent_sequences(emitter *yaml_emitter_t, indent bool) {
+	emitter.indent_sequences = indent
+}
+
+// Set whether the start marker of documents after the first is omitted.
+func yaml_emitter_set_implicit_documents(emitter *yaml_emitter_t, implicit bool) {
+	emitter.implicit_documents = implicit
+}
+
+// Set whether the line break ending each document is only written
+// when another document follows.
+func yaml_emitter_set_final_break(emitter *yaml_emitter_t, final_break bool) {
+	emitter.no_final_break = !final_break
+}
+
+// Set whether lines are broken between the items of flow collections
+// and within their scalars when they get too long.
+func yaml_emitter_set_flow_breaks(emitter *yaml_emitter_t, wraps, folds bool) {
+	emitter.no_flow_wraps = !wraps
+	emitter.no_flow_folds = !folds
+}
+
 // Set the preferred line width.
 func yaml_emitter_set_width(emitter *yaml_emitter_t, width int) {
 	if width < 0 {
@@ -317,6 +340,15 @@ func yaml_document_end_event_initialize(event *yaml_event_t, implicit bool) {
 //    return 1
 //}
 
+// Create ALIAS.
+func yaml_alias_event_initialize(event *yaml_event_t, anchor []byte) bool {
+	*event = yaml_event_t{
+		typ:    yaml_ALIAS_EVENT,
+		anchor: anchor,
+	}
+	return true
+}
+
 // Create SCALAR.
 func yaml_scalar_event_initialize(event *yaml_event_t, anchor, tag, value []byte, plain_implicit, quoted_implicit bool, style yaml_scalar_style_t) bool {
 	*event = yaml_event_t{
@@ -1,13 +1,21 @@
 package yaml
 
 import (
+	"bytes"
+	"context"
 	"encoding"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"math"
+	"math/big"
+	"net"
+	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -39,6 +47,43 @@ type parser struct {
 	event    yaml_event_t
 	doc      *node
 	doneInit bool
+
+	// source holds a copy of the input read by the parser
+	// when source lines are retained, or nil otherwise.
+	// reader holds the original input reader in that case.
+	source *bytes.Buffer
+	reader io.Reader
+
+	// lineOffset and columnOffset are added to line and column
+	// numbers in error messages.
+	lineOffset   int
+	columnOffset int
+
+	// filename, if set, names the input in error messages.
+	filename string
+
+	// depth is the current collection nesting depth, limited
+	// by maxDepth when it's greater than zero.
+	depth    int
+	maxDepth int
+
+	// end is the end position of the last event consumed.
+	end yaml_mark_t
+
+	// documents is the number of documents read, limited by
+	// maxDocuments when it's greater than zero.
+	documents    int
+	maxDocuments int
+
+	// bom restricts whether the input starts with a byte order mark.
+	bom BOMPolicy
+
+	// noAnchors rejects input with anchors or aliases.
+	noAnchors bool
+
+	// ctx, if set, aborts parsing when done.
+	ctx    context.Context
+	events int
 }
 
 func newParser(b []byte) *parser {
@@ -62,11 +107,59 @@ func newParserFromReader(r io.Reader) *parser {
 	return &p
 }
 
+// include returns a parser for the document b included by the input
+// of p, with the same limits and settings as p, or with none if p is nil.
+func (p *parser) include(b []byte) *parser {
+	sub := newParser(b)
+	if p != nil {
+		sub.maxDepth = p.maxDepth
+		sub.maxDocuments = p.maxDocuments
+		sub.bom = p.bom
+		sub.noAnchors = p.noAnchors
+		sub.expandTabs(p.parser.tab_width)
+	}
+	return sub
+}
+
+// expandTabs makes the parser accept tabs in indentation, reaching
+// the next multiple of width columns.
+func (p *parser) expandTabs(width int) {
+	p.parser.tab_width = width
+}
+
+// retainSource sets whether the parser keeps a copy of all input it
+// reads, so that error messages can quote the lines they refer to.
+func (p *parser) retainSource(enabled bool) {
+	if enabled == (p.source != nil) {
+		return
+	}
+	if !enabled {
+		p.source = nil
+		if p.reader != nil {
+			p.parser.input_reader = p.reader
+		}
+		return
+	}
+	p.source = new(bytes.Buffer)
+	if p.parser.input_reader != nil {
+		p.reader = p.parser.input_reader
+		p.parser.input_reader = io.TeeReader(p.reader, p.source)
+	} else {
+		p.source.Write(p.parser.input)
+	}
+}
+
 func (p *parser) init() {
 	if p.doneInit {
 		return
 	}
 	p.expect(yaml_STREAM_START_EVENT)
+	switch {
+	case p.bom == BOMRequire && !p.parser.bom:
+		failf("%sbyte order mark is required", lineLabel(p.filename, 1+p.lineOffset))
+	case p.bom == BOMForbid && p.parser.bom:
+		failf("%sbyte order mark is not allowed", lineLabel(p.filename, 1+p.lineOffset))
+	}
 	p.doneInit = true
 }
 
@@ -77,13 +170,30 @@ func (p *parser) destroy() {
 	yaml_parser_delete(&p.parser)
 }
 
+// contextCheckInterval is the number of events parsed or values
+// decoded between checks of the context passed to DecodeContext.
+const contextCheckInterval = 100
+
+// next parses the next event into p.event.
+func (p *parser) next() {
+	if p.ctx != nil {
+		p.events++
+		if p.events%contextCheckInterval == 0 {
+			if err := p.ctx.Err(); err != nil {
+				fail(err)
+			}
+		}
+	}
+	if !yaml_parser_parse(&p.parser, &p.event) {
+		p.fail()
+	}
+}
+
 // expect consumes an event from the event stream and
 // checks that it's of the expected type.
 func (p *parser) expect(e yaml_event_type_t) {
 	if p.event.typ == yaml_NO_EVENT {
-		if !yaml_parser_parse(&p.parser, &p.event) {
-			p.fail()
-		}
+		p.next()
 	}
 	if p.event.typ == yaml_STREAM_END_EVENT {
 		failf("attempted to go past the end of stream; corrupted value?")
@@ -92,6 +202,7 @@ func (p *parser) expect(e yaml_event_type_t) {
 		p.parser.problem = fmt.Sprintf("expected %s event but got %s", e, p.event.typ)
 		p.fail()
 	}
+	p.end = p.event.end_mark
 	yaml_event_delete(&p.event)
 	p.event.typ = yaml_NO_EVENT
 }
@@ -102,16 +213,20 @@ func (p *parser) peek() yaml_event_type_t {
 	if p.event.typ != yaml_NO_EVENT {
 		return p.event.typ
 	}
-	if !yaml_parser_parse(&p.parser, &p.event) {
-		p.fail()
-	}
+	p.next()
 	return p.event.typ
 }
 
 func (p *parser) fail() {
 	var where string
 	var line int
-	if p.parser.problem_mark.line != 0 {
+	if p.parser.error == yaml_READER_ERROR {
+		// Reader errors are found ahead of the scanner, at the
+		// position the reader tracks itself.
+		line = p.parser.problem_mark.line + 1
+	} else if p.tabError() {
+		line = p.parser.problem_mark.line + 1
+	} else if p.parser.problem_mark.line != 0 {
 		line = p.parser.problem_mark.line
 		// Scanner errors don't iterate line before returning error
 		if p.parser.error == yaml_SCANNER_ERROR {
@@ -121,7 +236,9 @@ func (p *parser) fail() {
 		line = p.parser.context_mark.line
 	}
 	if line != 0 {
-		where = "line " + strconv.Itoa(line) + ": "
+		where = lineLabel(p.filename, line+p.lineOffset)
+	} else if p.filename != "" {
+		where = p.filename + ": "
 	}
 	var msg string
 	if len(p.parser.problem) > 0 {
@@ -129,11 +246,57 @@ func (p *parser) fail() {
 	} else {
 		msg = "unknown problem parsing YAML content"
 	}
+	if p.tabError() {
+		msg += fmt.Sprintf(" (replace the tab at column %d with spaces)", p.parser.problem_mark.column+1+p.columnOffset)
+	}
+	if line != 0 {
+		msg = withSourceLine(msg, p.source, line-1)
+	}
 	failf("%s%s", where, msg)
 }
 
+// tabError reports whether the parser stopped at a scanner error on a
+// tab character, which is most often a tab used for indentation.
+func (p *parser) tabError() bool {
+	pp := &p.parser
+	return pp.error == yaml_SCANNER_ERROR && pp.buffer_pos < len(pp.buffer) && is_tab(pp.buffer, pp.buffer_pos)
+}
+
+// lineLabel returns the prefix of an error message about the given
+// line, counted from 1, of the input named filename: "name:12: " if
+// filename is set or "line 12: " otherwise.
+func lineLabel(filename string, line int) string {
+	if filename != "" {
+		return filename + ":" + strconv.Itoa(line) + ": "
+	}
+	return "line " + strconv.Itoa(line) + ": "
+}
+
+// withSourceLine appends the text of the given zero-based line
+// of source to msg, if source is available.
+func withSourceLine(msg string, source *bytes.Buffer, line int) string {
+	if source == nil {
+		return msg
+	}
+	data := source.Bytes()
+	for ; line > 0; line-- {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return msg
+		}
+		data = data[i+1:]
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[:i]
+	}
+	return msg + "\n    | " + string(bytes.TrimRight(data, "\r"))
+}
+
 func (p *parser) anchor(n *node, anchor []byte) {
 	if anchor != nil {
+		if p.noAnchors {
+			failf("%sanchor '%s' is not allowed", lineLabel(p.filename, n.line+1+p.lineOffset), anchor)
+		}
 		p.doc.anchors[string(anchor)] = n
 	}
 }
@@ -168,6 +331,7 @@ func (p *parser) node(kind int) *node {
 }
 
 func (p *parser) document() *node {
+	p.countDocument()
 	n := p.node(documentNode)
 	n.anchors = make(map[string]*node)
 	p.doc = n
@@ -177,9 +341,21 @@ func (p *parser) document() *node {
 	return n
 }
 
+// countDocument counts a document about to be read, failing if there
+// are more than maxDocuments.
+func (p *parser) countDocument() {
+	p.documents++
+	if p.maxDocuments > 0 && p.documents > p.maxDocuments {
+		failf("%sexceeded max of %d documents", lineLabel(p.filename, p.event.start_mark.line+1+p.lineOffset), p.maxDocuments)
+	}
+}
+
 func (p *parser) alias() *node {
 	n := p.node(aliasNode)
 	n.value = string(p.event.anchor)
+	if p.noAnchors {
+		failf("%salias '%s' is not allowed", lineLabel(p.filename, n.line+1+p.lineOffset), n.value)
+	}
 	n.alias = p.doc.anchors[n.value]
 	if n.alias == nil {
 		failf("unknown anchor '%s' referenced", n.value)
@@ -200,52 +376,121 @@ func (p *parser) scalar() *node {
 
 func (p *parser) sequence() *node {
 	n := p.node(sequenceNode)
+	n.tag = string(p.event.tag)
 	p.anchor(n, p.event.anchor)
 	p.expect(yaml_SEQUENCE_START_EVENT)
+	p.enter()
 	for p.peek() != yaml_SEQUENCE_END_EVENT {
 		n.children = append(n.children, p.parse())
 	}
+	p.depth--
 	p.expect(yaml_SEQUENCE_END_EVENT)
 	return n
 }
 
 func (p *parser) mapping() *node {
 	n := p.node(mappingNode)
+	n.tag = string(p.event.tag)
 	p.anchor(n, p.event.anchor)
 	p.expect(yaml_MAPPING_START_EVENT)
+	p.enter()
 	for p.peek() != yaml_MAPPING_END_EVENT {
 		n.children = append(n.children, p.parse(), p.parse())
 	}
+	p.depth--
 	p.expect(yaml_MAPPING_END_EVENT)
 	return n
 }
 
+// enter records that the parser entered a nested collection,
+// failing if that exceeds the maximum depth.
+func (p *parser) enter() {
+	p.depth++
+	if p.maxDepth > 0 && p.depth > p.maxDepth {
+		failf("exceeded max depth of %d", p.maxDepth)
+	}
+}
+
 // ----------------------------------------------------------------------------
 // Decoder, unmarshals a node into a provided value.
 
 type decoder struct {
-	doc     *node
-	aliases map[*node]bool
-	mapType reflect.Type
-	terrors []string
-	strict  bool
+	decodeOptions
+
+	// source holds the input read so far when source lines
+	// are retained for error messages, or nil otherwise.
+	source *bytes.Buffer
+
+	// ctx, if set, aborts decoding when done.
+	ctx context.Context
+
+	// parser, if set, is the parser of the input being decoded,
+	// whose limits also apply to the documents it includes.
+	parser *parser
+
+	// unmarshalCtx, if set, is passed to ContextUnmarshaler values.
+	unmarshalCtx context.Context
+
+	// mergedFields tracks the fields of the struct being merged
+	// into, while decoding the value of a merge key.
+	mergedFields []bool
+
+	// including holds the names of the documents being included,
+	// outermost first, to detect include cycles.
+	including []string
+
+	// constructing holds the node being decoded by a tag constructor,
+	// which must not be handed to the constructor again.
+	constructing *node
+
+	// timeFormat holds the layout of the struct field being decoded,
+	// from its format tag flag.
+	timeFormat string
+
+	doc      *node
+	aliases  map[*node]bool
+	mapType  reflect.Type
+	terrors  []string
+	warnings []string
 
 	decodeCount int
 	aliasCount  int
 	aliasDepth  int
+
+	// mapKey holds whether the scalar being decoded is a map key,
+	// and keyErr the error of its UnmarshalText method, which is then
+	// reported at the key rather than aborting the whole document.
+	mapKey bool
+	keyErr error
 }
 
 var (
 	mapItemType    = reflect.TypeOf(MapItem{})
+	setType        = reflect.TypeOf(Set{})
 	durationType   = reflect.TypeOf(time.Duration(0))
 	defaultMapType = reflect.TypeOf(map[interface{}]interface{}{})
 	ifaceType      = defaultMapType.Elem()
 	timeType       = reflect.TypeOf(time.Time{})
 	ptrTimeType    = reflect.TypeOf(&time.Time{})
+	ipNetType      = reflect.TypeOf(net.IPNet{})
+	urlType        = reflect.TypeOf(url.URL{})
+	bigIntType     = reflect.TypeOf(big.Int{})
+	bigFloatType   = reflect.TypeOf(big.Float{})
+	bigRatType     = reflect.TypeOf(big.Rat{})
+
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
 )
 
-func newDecoder(strict bool) *decoder {
-	d := &decoder{mapType: defaultMapType, strict: strict}
+// addressTypes holds the network address types whose invalid values
+// are reported as type errors at the line of the value, rather than
+// by aborting with the error returned by their UnmarshalText method.
+var addressTypes = map[reflect.Type]bool{
+	reflect.TypeOf(net.IP(nil)): true,
+	ipNetType:                   true,
+}
+
+func newDecoder(opts decodeOptions) *decoder {
+	d := &decoder{decodeOptions: opts, mapType: defaultMapType}
 	d.aliases = make(map[*node]bool)
 	return d
 }
@@ -255,19 +500,64 @@ func (d *decoder) terror(n *node, tag string, out reflect.Value) {
 		tag = n.tag
 	}
 	value := n.value
-	if tag != yaml_SEQ_TAG && tag != yaml_MAP_TAG {
-		if len(value) > 10 {
-			value = " `" + value[:7] + "...`"
-		} else {
-			value = " `" + value + "`"
-		}
+	if n.kind == scalarNode && tag != yaml_SEQ_TAG && tag != yaml_MAP_TAG {
+		value = " `" + d.truncate(value) + "`"
+	}
+	d.terrorf(n, "cannot unmarshal %s%s into %s", shortTag(tag), value, out.Type())
+}
+
+// terrorf records a type error found while decoding n.
+func (d *decoder) terrorf(n *node, format string, args ...interface{}) {
+	d.terrors = append(d.terrors, d.message(n, format, args...))
+}
+
+// warnf records a warning about n.
+func (d *decoder) warnf(n *node, format string, args ...interface{}) {
+	d.warnings = append(d.warnings, d.message(n, format, args...))
+}
+
+// message formats a type error or warning about n.
+func (d *decoder) message(n *node, format string, args ...interface{}) string {
+	msg := d.label(n) + fmt.Sprintf(format, args...)
+	return withSourceLine(msg, d.source, n.line)
+}
+
+// label returns the prefix of error messages about n.
+func (d *decoder) label(n *node) string {
+	return lineLabel(d.filename, n.line+1+d.lineOffset)
+}
+
+// truncate abbreviates value for inclusion in an error message.
+func (d *decoder) truncate(value string) string {
+	if d.valueLimit <= 0 || len(value) <= d.valueLimit {
+		return value
+	}
+	cut := d.valueLimit - len(d.ellipsis)
+	if cut < 0 {
+		cut = 0
 	}
-	d.terrors = append(d.terrors, fmt.Sprintf("line %d: cannot unmarshal %s%s into %s", n.line+1, shortTag(tag), value, out.Type()))
+	return value[:cut] + d.ellipsis
 }
 
 func (d *decoder) callUnmarshaler(n *node, u Unmarshaler) (good bool) {
+	return d.callUnmarshalFunc(n, u.UnmarshalYAML)
+}
+
+func (d *decoder) callContextUnmarshaler(n *node, u ContextUnmarshaler) (good bool) {
+	ctx := d.unmarshalCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return d.callUnmarshalFunc(n, func(unmarshal func(interface{}) error) error {
+		return u.UnmarshalYAMLContext(ctx, unmarshal)
+	})
+}
+
+// callUnmarshalFunc calls f, the method of a custom unmarshaler, with a
+// function that unmarshals n.
+func (d *decoder) callUnmarshalFunc(n *node, f func(unmarshal func(interface{}) error) error) (good bool) {
 	terrlen := len(d.terrors)
-	err := u.UnmarshalYAML(func(v interface{}) (err error) {
+	err := f(func(v interface{}) (err error) {
 		defer handleErr(&err)
 		d.unmarshal(n, reflect.ValueOf(v))
 		if len(d.terrors) > terrlen {
@@ -287,6 +577,206 @@ func (d *decoder) callUnmarshaler(n *node, u Unmarshaler) (good bool) {
 	return true
 }
 
+// callDecodeHooks calls the decoder's hooks in turn until one of them
+// provides a value for out, and stores that value. It reports whether
+// a hook handled out, and if so whether it did so successfully.
+func (d *decoder) callDecodeHooks(n *node, out reflect.Value) (done, good bool) {
+	for _, hook := range d.decodeHooks {
+		var v interface{}
+		var ok bool
+		good = d.callUnmarshalFunc(n, func(unmarshal func(interface{}) error) (err error) {
+			v, ok, err = hook(out.Type(), unmarshal)
+			return err
+		})
+		if !good {
+			return true, false
+		}
+		if !ok {
+			continue
+		}
+		return true, d.store(n, out, v, "decode hook")
+	}
+	return false, false
+}
+
+const includeTag = "!include"
+
+// include decodes into out the document named by n, a scalar with the
+// !include tag. Errors found in that document are reported at n.
+func (d *decoder) include(n *node, out reflect.Value) (good bool) {
+	name := n.value
+	for i, including := range d.including {
+		if including == name {
+			chain := append(append([]string(nil), d.including[i:]...), name)
+			d.terrorf(n, "include cycle: %s", strings.Join(chain, " -> "))
+			return false
+		}
+	}
+	data, err := d.includes.ResolveInclude(name)
+	if err != nil {
+		d.terrorf(n, "cannot include %s: %v", name, err)
+		return false
+	}
+	sub := newDecoder(d.decodeOptions)
+	sub.lineOffset, sub.columnOffset = 0, 0
+	sub.filename = ""
+	sub.ctx = d.ctx
+	sub.unmarshalCtx = d.unmarshalCtx
+	sub.including = append(append([]string(nil), d.including...), name)
+	// The nodes of included documents count against the limits of
+	// the including one.
+	sub.decodeCount, sub.aliasCount = d.decodeCount, d.aliasCount
+	err = func() (err error) {
+		defer handleErr(&err)
+		p := d.parser.include(data)
+		defer p.destroy()
+		p.ctx = d.ctx
+		sub.parser = p
+		if doc := p.parse(); doc != nil {
+			sub.unmarshal(doc, out)
+		}
+		return nil
+	}()
+	d.decodeCount, d.aliasCount = sub.decodeCount, sub.aliasCount
+	for _, w := range sub.warnings {
+		d.warnf(n, "in %s: %s", name, w)
+	}
+	for _, e := range sub.terrors {
+		d.terrorf(n, "in %s: %s", name, e)
+	}
+	if err != nil {
+		d.terrorf(n, "in %s: %s", name, strings.TrimPrefix(err.Error(), "yaml: "))
+		return false
+	}
+	return len(sub.terrors) == 0
+}
+
+// construct decodes n into out using fn, the constructor registered
+// for the tag of n.
+func (d *decoder) construct(n *node, fn TagConstructor, out reflect.Value) (good bool) {
+	var v interface{}
+	good = d.callUnmarshalFunc(n, func(unmarshal func(interface{}) error) (err error) {
+		constructing := d.constructing
+		d.constructing = n
+		defer func() { d.constructing = constructing }()
+		v, err = fn(unmarshal)
+		if _, ok := err.(*TypeError); err != nil && !ok {
+			err = &TypeError{[]string{d.message(n, "cannot construct %s value: %v", shortTag(n.tag), err)}}
+		}
+		return err
+	})
+	if !good {
+		return false
+	}
+	return d.store(n, out, v, shortTag(n.tag)+" constructor")
+}
+
+// handlesTag returns whether the tag of n is handled by a constructor
+// registered with Decoder.RegisterTag or by the includes.
+func (d *decoder) handlesTag(n *node) bool {
+	if _, ok := d.tags[n.tag]; ok {
+		return true
+	}
+	return n.tag == includeTag && d.includes != nil
+}
+
+// tagged decodes n into a new value of the type registered for its tag,
+// and stores it into the interface value out.
+func (d *decoder) tagged(n *node, out reflect.Value) (good bool) {
+	t, ok := d.types[n.tag]
+	if !ok {
+		var tags []string
+		for tag := range d.types {
+			tags = append(tags, shortTag(tag))
+		}
+		sort.Strings(tags)
+		d.terrorf(n, "unknown tag %s; registered tags are %s", shortTag(n.tag), strings.Join(tags, ", "))
+		return false
+	}
+	return d.instantiate(n, t, out, shortTag(n.tag))
+}
+
+// union holds the types registered with Decoder.RegisterUnion for an
+// interface type, by the value of the discriminator key.
+type union struct {
+	key   string
+	types map[string]reflect.Type
+}
+
+// union decodes the mapping n into a new value of the type registered
+// in u for the value of its discriminator key, and stores it into the
+// interface value out.
+func (d *decoder) union(n *node, u *union, out reflect.Value) (good bool) {
+	var kinds []string
+	for kind := range u.types {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	kn := d.lookupKey(n, u.key)
+	if kn == nil {
+		d.terrorf(n, "missing %s for %s; valid %ss are %s", u.key, out.Type(), u.key, strings.Join(kinds, ", "))
+		return false
+	}
+	kn = resolveAlias(kn)
+	t, ok := u.types[kn.value]
+	if !ok || kn.kind != scalarNode {
+		d.terrorf(kn, "unknown %s %s for %s; valid %ss are %s", u.key, d.truncate(kn.value), out.Type(), u.key, strings.Join(kinds, ", "))
+		return false
+	}
+	return d.instantiate(n, t, out, u.key+" "+kn.value)
+}
+
+// instantiate decodes n into a new value of type t, registered for the
+// given source, and stores it into the interface value out.
+func (d *decoder) instantiate(n *node, t reflect.Type, out reflect.Value, source string) (good bool) {
+	addr := false
+	if !t.AssignableTo(out.Type()) {
+		if !reflect.PtrTo(t).AssignableTo(out.Type()) {
+			d.terrorf(n, "type %s registered for %s does not implement %s", t, source, out.Type())
+			return false
+		}
+		addr = true
+	}
+	v := reflect.New(t)
+	if !d.unmarshal(n, v.Elem()) {
+		return false
+	}
+	if addr {
+		out.Set(v)
+	} else {
+		out.Set(v.Elem())
+	}
+	return true
+}
+
+// store stores v, provided by source while decoding n, into out,
+// following pointers in out as necessary.
+func (d *decoder) store(n *node, out reflect.Value, v interface{}, source string) bool {
+	if v == nil {
+		out.Set(reflect.Zero(out.Type()))
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	for {
+		switch {
+		case rv.Type().AssignableTo(out.Type()):
+			out.Set(rv)
+			return true
+		case rv.Kind() == out.Kind() && rv.Type().ConvertibleTo(out.Type()):
+			out.Set(rv.Convert(out.Type()))
+			return true
+		case out.Kind() == reflect.Ptr:
+			if out.IsNil() {
+				out.Set(reflect.New(out.Type().Elem()))
+			}
+			out = out.Elem()
+			continue
+		}
+		d.terrorf(n, "%s returned %s for %s", source, rv.Type(), out.Type())
+		return false
+	}
+}
+
 // d.prepare initializes and dereferences pointers and calls UnmarshalYAML
 // if a value is found to implement it.
 // It returns the initialized and dereferenced out value, whether
@@ -295,12 +785,35 @@ func (d *decoder) callUnmarshaler(n *node, u Unmarshaler) (good bool) {
 //
 // If n holds a null value, prepare returns before doing anything.
 func (d *decoder) prepare(n *node, out reflect.Value) (newout reflect.Value, unmarshaled, good bool) {
-	if n.tag == yaml_NULL_TAG || n.kind == scalarNode && n.tag == "" && (n.value == "null" || n.value == "~" || n.value == "" && n.implicit) {
+	if n.kind == scalarNode && (n.tag == yaml_NULL_TAG || n.tag == "" && (n.value == "null" || n.value == "~" || n.value == "" && n.implicit)) {
 		return out, false, false
 	}
+	if n.tag == yaml_NULL_TAG {
+		d.terrorf(n, "cannot unmarshal a %s with tag !!null", kindName(n.kind))
+		return out, true, false
+	}
+	if n.tag == includeTag && d.includes != nil && n.kind == scalarNode {
+		return out, true, d.include(n, out)
+	}
+	if fn, ok := d.tags[n.tag]; ok && n != d.constructing && out.CanSet() {
+		return out, true, d.construct(n, fn, out)
+	}
+	if out.Kind() == reflect.Interface {
+		if len(d.types) > 0 && n.tag != "" && n.tag != "!" && !strings.HasPrefix(n.tag, longTagPrefix) && !d.handlesTag(n) {
+			return out, true, d.tagged(n, out)
+		}
+		if u, ok := d.unions[out.Type()]; ok && n.kind == mappingNode {
+			return out, true, d.union(n, u, out)
+		}
+	}
 	again := true
 	for again {
 		again = false
+		if len(d.decodeHooks) > 0 && out.CanSet() {
+			if done, good := d.callDecodeHooks(n, out); done {
+				return out, true, good
+			}
+		}
 		if out.Kind() == reflect.Ptr {
 			if out.IsNil() {
 				out.Set(reflect.New(out.Type().Elem()))
@@ -309,6 +822,10 @@ func (d *decoder) prepare(n *node, out reflect.Value) (newout reflect.Value, unm
 			again = true
 		}
 		if out.CanAddr() {
+			if u, ok := out.Addr().Interface().(ContextUnmarshaler); ok {
+				good = d.callContextUnmarshaler(n, u)
+				return out, true, good
+			}
 			if u, ok := out.Addr().Interface().(Unmarshaler); ok {
 				good = d.callUnmarshaler(n, u)
 				return out, true, good
@@ -347,14 +864,28 @@ func allowedAliasRatio(decodeCount int) float64 {
 	}
 }
 
+// checkAliasing fails if too many of the nodes decoded so far come
+// from the expansion of aliases.
+func (d *decoder) checkAliasing() {
+	if d.aliasCount > 100 && d.decodeCount > 1000 && float64(d.aliasCount)/float64(d.decodeCount) > allowedAliasRatio(d.decodeCount) {
+		failf("document contains excessive aliasing")
+	}
+}
+
 func (d *decoder) unmarshal(n *node, out reflect.Value) (good bool) {
 	d.decodeCount++
+	if d.maxNodes > 0 && d.decodeCount > d.maxNodes {
+		failf("%sexceeded max of %d nodes", d.label(n), d.maxNodes)
+	}
+	if d.ctx != nil && d.decodeCount%contextCheckInterval == 0 {
+		if err := d.ctx.Err(); err != nil {
+			fail(err)
+		}
+	}
 	if d.aliasDepth > 0 {
 		d.aliasCount++
 	}
-	if d.aliasCount > 100 && d.decodeCount > 1000 && float64(d.aliasCount)/float64(d.decodeCount) > allowedAliasRatio(d.decodeCount) {
-		failf("document contains excessive aliasing")
-	}
+	d.checkAliasing()
 	switch n.kind {
 	case documentNode:
 		return d.document(n, out)
@@ -375,9 +906,33 @@ func (d *decoder) unmarshal(n *node, out reflect.Value) (good bool) {
 	default:
 		panic("internal error: unknown node kind: " + strconv.Itoa(n.kind))
 	}
+	if good {
+		d.validate(n, out)
+	}
 	return good
 }
 
+// validate calls the ValidateYAML method of out, a value decoded from n,
+// and the decoder's validator if out is a struct, reporting their
+// errors as type errors at n.
+func (d *decoder) validate(n *node, out reflect.Value) {
+	v := out
+	if out.CanAddr() {
+		v = out.Addr()
+	}
+	if u, ok := v.Interface().(Validator); ok {
+		if err := u.ValidateYAML(); err != nil {
+			d.terrorf(n, "invalid %s: %v", out.Type(), err)
+			return
+		}
+	}
+	if d.validator != nil && out.Kind() == reflect.Struct {
+		if err := d.validator(v.Interface()); err != nil {
+			d.terrorf(n, "invalid %s: %v", out.Type(), err)
+		}
+	}
+}
+
 func (d *decoder) document(n *node, out reflect.Value) (good bool) {
 	if len(n.children) == 1 {
 		d.doc = n
@@ -387,6 +942,70 @@ func (d *decoder) document(n *node, out reflect.Value) (good bool) {
 	return false
 }
 
+// lookupPath returns the node at path in the document n, as described
+// for Decoder.DecodePath.
+func (d *decoder) lookupPath(n *node, path string) *node {
+	segments := strings.Split(path, ".")
+	for i, seg := range segments {
+		n = resolveAlias(n)
+		if n.kind == documentNode {
+			if len(n.children) == 0 {
+				failf("path %s: document is empty", path)
+			}
+			n = resolveAlias(n.children[0])
+		}
+		var next *node
+		switch n.kind {
+		case mappingNode:
+			next = d.lookupKey(n, seg)
+		case sequenceNode:
+			index, err := strconv.Atoi(seg)
+			if err != nil {
+				failf("%spath %s: cannot look up %q in a sequence", d.label(n), path, seg)
+			}
+			if index >= 0 && index < len(n.children) {
+				next = n.children[index]
+			}
+		default:
+			failf("%spath %s: cannot look up %q in a scalar", d.label(n), path, seg)
+		}
+		if next == nil {
+			failf("%spath %s: %s not found", d.label(n), path, strings.Join(segments[:i+1], "."))
+		}
+		n = next
+	}
+	return n
+}
+
+// lookupKey returns the value of key in the mapping n, or in the
+// mappings it merges, or nil if there is none.
+func (d *decoder) lookupKey(n *node, key string) *node {
+	l := len(n.children)
+	for i := 0; i < l; i += 2 {
+		if k := resolveAlias(n.children[i]); k.kind == scalarNode && k.value == key && !d.isMerge(k) {
+			return n.children[i+1]
+		}
+	}
+	for i := 0; i < l; i += 2 {
+		if !d.isMerge(resolveAlias(n.children[i])) {
+			continue
+		}
+		merged := resolveAlias(n.children[i+1])
+		sources := []*node{merged}
+		if merged.kind == sequenceNode {
+			sources = merged.children
+		}
+		for _, m := range sources {
+			if m = resolveAlias(m); m.kind == mappingNode {
+				if v := d.lookupKey(m, key); v != nil {
+					return v
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func (d *decoder) alias(n *node, out reflect.Value) (good bool) {
 	if d.aliases[n] {
 		// TODO this could actually be allowed in some circumstances.
@@ -409,13 +1028,25 @@ func resetMap(out reflect.Value) {
 }
 
 func (d *decoder) scalar(n *node, out reflect.Value) bool {
+	mapKey := d.mapKey
+	d.mapKey = false
+	if d.lookupEnv != nil && strings.Contains(n.value, "${") {
+		value, err := expandEnv(n.value, d.lookupEnv)
+		if err != nil {
+			d.terrorf(n, "%v", err)
+			return false
+		}
+		expanded := *n
+		expanded.value = value
+		n = &expanded
+	}
 	var tag string
 	var resolved interface{}
 	if n.tag == "" && !n.implicit {
 		tag = yaml_STR_TAG
 		resolved = n.value
 	} else {
-		tag, resolved = resolve(n.tag, n.value)
+		tag, resolved = d.resolve(n.tag, n.value)
 		if tag == yaml_BINARY_TAG {
 			data, err := base64.StdEncoding.DecodeString(resolved.(string))
 			if err != nil {
@@ -425,6 +1056,16 @@ func (d *decoder) scalar(n *node, out reflect.Value) bool {
 		}
 	}
 	if resolved == nil {
+		if k := out.Kind(); d.nulls != NullZero && k != reflect.Ptr && k != reflect.Interface {
+			if d.nulls == NullError {
+				d.terrorf(n, "null is not allowed for %s", out.Type())
+				return false
+			}
+			if v, ok := d.nullValues[out.Type()]; ok {
+				out.Set(v)
+				return true
+			}
+		}
 		if out.Kind() == reflect.Map && !out.CanAddr() {
 			resetMap(out)
 		} else {
@@ -432,6 +1073,33 @@ func (d *decoder) scalar(n *node, out reflect.Value) bool {
 		}
 		return true
 	}
+	if out.Type() == timeType && (d.timeFormat != "" || len(d.timeLayouts) > 0) {
+		return d.timeValue(n, resolved, out)
+	}
+	switch out.Type() {
+	case ipNetType:
+		_, ipnet, err := net.ParseCIDR(n.value)
+		if err != nil {
+			d.terrorf(n, "invalid address `%s` for %s", d.truncate(n.value), out.Type())
+			return false
+		}
+		out.Set(reflect.ValueOf(*ipnet))
+		return true
+	case urlType:
+		u, err := url.Parse(n.value)
+		if err != nil {
+			d.terrorf(n, "invalid URL `%s` for %s", d.truncate(n.value), out.Type())
+			return false
+		}
+		out.Set(reflect.ValueOf(*u))
+		return true
+	case bigIntType, bigFloatType, bigRatType:
+		if d.bigNumber(n, resolved, out) {
+			return true
+		}
+		d.terror(n, tag, out)
+		return false
+	}
 	if resolvedv := reflect.ValueOf(resolved); out.Type() == resolvedv.Type() {
 		// We've resolved to exactly the type we want, so use that.
 		out.Set(resolvedv)
@@ -452,12 +1120,24 @@ func (d *decoder) scalar(n *node, out reflect.Value) bool {
 				text = []byte(n.value)
 			}
 			err := u.UnmarshalText(text)
+			if err != nil && addressTypes[out.Type()] {
+				d.terrorf(n, "invalid address `%s` for %s", d.truncate(n.value), out.Type())
+				return false
+			}
+			if err != nil && mapKey {
+				d.keyErr = err
+				return false
+			}
 			if err != nil {
 				fail(err)
 			}
 			return true
 		}
 	}
+	if d.exact && !exactNumber(out, resolved) {
+		d.terrorf(n, "cannot unmarshal %s `%s` into %s without loss", shortTag(tag), d.truncate(n.value), out.Type())
+		return false
+	}
 	switch out.Kind() {
 	case reflect.String:
 		if tag == yaml_BINARY_TAG {
@@ -478,6 +1158,10 @@ func (d *decoder) scalar(n *node, out reflect.Value) bool {
 			// see a string and not a time.Time.
 			// TODO(v3) Drop this.
 			out.Set(reflect.ValueOf(n.value))
+		} else if d.useNumber && (tag == yaml_INT_TAG || tag == yaml_FLOAT_TAG) {
+			out.Set(reflect.ValueOf(Number(n.value)))
+		} else if v, ok := d.wideInt(n, resolved); ok {
+			out.Set(reflect.ValueOf(v))
 		} else {
 			out.Set(reflect.ValueOf(resolved))
 		}
@@ -500,17 +1184,22 @@ func (d *decoder) scalar(n *node, out reflect.Value) bool {
 				return true
 			}
 		case float64:
+			if d.strictScalars {
+				break
+			}
 			if resolved <= math.MaxInt64 && !out.OverflowInt(int64(resolved)) {
 				out.SetInt(int64(resolved))
 				return true
 			}
 		case string:
 			if out.Type() == durationType {
-				d, err := time.ParseDuration(resolved)
-				if err == nil {
-					out.SetInt(int64(d))
-					return true
+				dur, err := time.ParseDuration(resolved)
+				if err != nil {
+					d.terrorf(n, "invalid duration `%s` for %s", d.truncate(n.value), out.Type())
+					return false
 				}
+				out.SetInt(int64(dur))
+				return true
 			}
 		}
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
@@ -531,6 +1220,9 @@ func (d *decoder) scalar(n *node, out reflect.Value) bool {
 				return true
 			}
 		case float64:
+			if d.strictScalars {
+				break
+			}
 			if resolved <= math.MaxUint64 && !out.OverflowUint(uint64(resolved)) {
 				out.SetUint(uint64(resolved))
 				return true
@@ -557,6 +1249,10 @@ func (d *decoder) scalar(n *node, out reflect.Value) bool {
 			out.SetFloat(resolved)
 			return true
 		}
+	case reflect.Slice:
+		if s, ok := resolved.(string); ok && out.Type().Elem().Kind() == reflect.Uint8 {
+			return d.bytesValue(n, tag, s, out)
+		}
 	case reflect.Struct:
 		if resolvedv := reflect.ValueOf(resolved); out.Type() == resolvedv.Type() {
 			out.Set(resolvedv)
@@ -575,6 +1271,192 @@ func (d *decoder) scalar(n *node, out reflect.Value) bool {
 	return false
 }
 
+// bytesValue decodes the string s, resolved from the scalar n with
+// the given tag, into the byte slice out using the decoder's bytes
+// format. Values tagged !!binary have already been decoded from base64.
+// Other strings are read in the bytes format only, as the formats
+// cannot be told apart, and BytesSequence rejects them.
+func (d *decoder) bytesValue(n *node, tag, s string, out reflect.Value) bool {
+	b := []byte(s)
+	if tag != yaml_BINARY_TAG {
+		var err error
+		switch d.bytes {
+		case BytesSequence:
+			d.terror(n, tag, out)
+			return false
+		case BytesBase64:
+			b, err = base64.StdEncoding.DecodeString(s)
+		case BytesHex:
+			b, err = hex.DecodeString(s)
+		}
+		if err != nil {
+			d.terrorf(n, "invalid %s data `%s` for %s", bytesNames[d.bytes], d.truncate(n.value), out.Type())
+			return false
+		}
+	}
+	out.Set(reflect.ValueOf(b).Convert(out.Type()))
+	return true
+}
+
+var bytesNames = map[BytesFormat]string{BytesBase64: "base64", BytesHex: "hex"}
+
+// exactNumber reports whether the resolved value v can be stored into
+// out with no loss, if v is a number and out has a numeric kind.
+// Floats must have no fractional part to be stored into integers, and
+// must be in range to be stored into float32, and integers must be
+// exactly representable to be stored into floats.
+func exactNumber(out reflect.Value, v interface{}) bool {
+	var f float64
+	switch out.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f, ok := v.(float64)
+		return !ok || f == math.Trunc(f)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f, ok := v.(float64)
+		return !ok || f == math.Trunc(f) && f >= 0
+	case reflect.Float32, reflect.Float64:
+		switch v := v.(type) {
+		case float64:
+			return !out.OverflowFloat(v)
+		case int:
+			f = float64(v)
+		case int64:
+			f = float64(v)
+		case uint64:
+			f = float64(v)
+		default:
+			return true
+		}
+		if out.Kind() == reflect.Float32 {
+			f = float64(float32(f))
+		}
+	default:
+		return true
+	}
+	switch v := v.(type) {
+	case int:
+		return f >= math.MinInt64 && f < -math.MinInt64 && int64(f) == int64(v)
+	case int64:
+		return f >= math.MinInt64 && f < -math.MinInt64 && int64(f) == v
+	default:
+		return f < 2*-math.MinInt64 && uint64(f) == v.(uint64)
+	}
+}
+
+// resolve is like the resolve function, but applies the restrictions
+// on implicit typing that the decoder is configured with.
+func (d *decoder) resolve(tag, in string) (rtag string, out interface{}) {
+	if d.schema == SchemaCore {
+		rtag, out = resolveCore(tag, in)
+	} else {
+		rtag, out = resolve(tag, in)
+	}
+	if d.strictScalars && tag == "" {
+		switch {
+		case rtag == yaml_BOOL_TAG && !isCoreBool(in),
+			rtag == yaml_INT_TAG && isLegacyOctal(in) && d.schema != SchemaCore:
+			return yaml_STR_TAG, in
+		}
+	}
+	return rtag, out
+}
+
+// timeValue decodes the scalar n, which resolved to resolved, into the
+// time.Time out using the layout of the field being decoded or the
+// layouts of the decoder.
+func (d *decoder) timeValue(n *node, resolved interface{}, out reflect.Value) bool {
+	layouts := d.timeLayouts
+	if d.timeFormat != "" {
+		layouts = []string{d.timeFormat}
+	} else if t, ok := resolved.(time.Time); ok {
+		out.Set(reflect.ValueOf(t))
+		return true
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, n.value); err == nil {
+			out.Set(reflect.ValueOf(t))
+			return true
+		}
+	}
+	quoted := make([]string, len(layouts))
+	for i, layout := range layouts {
+		quoted[i] = strconv.Quote(layout)
+	}
+	noun := "layout"
+	if len(layouts) > 1 {
+		noun = "layouts"
+	}
+	d.terrorf(n, "cannot parse `%s` as %s using %s %s", d.truncate(n.value), out.Type(), noun, strings.Join(quoted, ", "))
+	return false
+}
+
+// bigNumber decodes the scalar n, which resolved to resolved, into out,
+// a big.Int, big.Float or big.Rat, without going through the limited
+// precision of the resolved value.
+func (d *decoder) bigNumber(n *node, resolved interface{}, out reflect.Value) bool {
+	switch out.Type() {
+	case bigIntType:
+		b := bigInteger(n.value, d.schema)
+		if b == nil {
+			return false
+		}
+		out.Set(reflect.ValueOf(*b))
+	case bigFloatType:
+		f := new(big.Float)
+		if fv, ok := resolved.(float64); ok && math.IsInf(fv, 0) {
+			f.SetInf(fv < 0)
+		} else {
+			s := strings.Replace(n.value, "_", "", -1)
+			// Keep at least as many bits as the text has digits.
+			prec := uint(len(s)) * 4
+			if prec < 64 {
+				prec = 64
+			}
+			if out.CanAddr() {
+				if old := out.Addr().Interface().(*big.Float).Prec(); old != 0 {
+					prec = old
+				}
+			}
+			var err error
+			f, _, err = big.ParseFloat(s, 10, prec, big.ToNearestEven)
+			if err != nil {
+				return false
+			}
+		}
+		out.Set(reflect.ValueOf(*f))
+	case bigRatType:
+		r, ok := new(big.Rat).SetString(strings.Replace(n.value, "_", "", -1))
+		if !ok {
+			return false
+		}
+		out.Set(reflect.ValueOf(*r))
+	}
+	return true
+}
+
+// wideInt returns the integer held by the scalar n, which resolved to
+// resolved, as an int64, a uint64 or a *big.Int when the decoder was
+// asked to use them. It reports false if that is not the case or n is
+// not an integer.
+func (d *decoder) wideInt(n *node, resolved interface{}) (interface{}, bool) {
+	if !d.useInt64 {
+		return nil, false
+	}
+	switch v := resolved.(type) {
+	case int:
+		return int64(v), true
+	case int64, uint64:
+		return v, true
+	}
+	if n.tag != "" && n.tag != yaml_INT_TAG || n.tag == "" && !n.implicit {
+		return nil, false
+	}
+	if b := bigInteger(n.value, d.schema); b != nil {
+		return b, true
+	}
+	return nil, false
+}
+
 func settableValueOf(i interface{}) reflect.Value {
 	v := reflect.ValueOf(i)
 	sv := reflect.New(v.Type()).Elem()
@@ -583,6 +1465,11 @@ func settableValueOf(i interface{}) reflect.Value {
 }
 
 func (d *decoder) sequence(n *node, out reflect.Value) (good bool) {
+	if n.tag == yaml_OMAP_TAG || n.tag == yaml_PAIRS_TAG {
+		if good, handled := d.pairs(n, out); handled {
+			return good
+		}
+	}
 	l := len(n.children)
 
 	var iface reflect.Value
@@ -621,6 +1508,13 @@ func (d *decoder) sequence(n *node, out reflect.Value) (good bool) {
 }
 
 func (d *decoder) mapping(n *node, out reflect.Value) (good bool) {
+	if d.mergeMode != MergeShallow && !d.noMerge {
+		n = d.deepMerged(n)
+	}
+	set := n.tag == yaml_SET_TAG
+	if set && !d.setMembers(n) {
+		return false
+	}
 	switch out.Kind() {
 	case reflect.Struct:
 		return d.mappingStruct(n, out)
@@ -629,7 +1523,11 @@ func (d *decoder) mapping(n *node, out reflect.Value) (good bool) {
 	case reflect.Map:
 		// okay
 	case reflect.Interface:
-		if d.mapType.Kind() == reflect.Map {
+		if set {
+			iface := out
+			out = reflect.MakeMap(setType)
+			iface.Set(out)
+		} else if d.mapType.Kind() == reflect.Map {
 			iface := out
 			out = reflect.MakeMap(d.mapType)
 			iface.Set(out)
@@ -657,39 +1555,162 @@ func (d *decoder) mapping(n *node, out reflect.Value) (good bool) {
 	if out.IsNil() {
 		out.Set(reflect.MakeMap(outt))
 	}
+	keyLines := d.keyLines()
 	l := len(n.children)
 	for i := 0; i < l; i += 2 {
-		if isMerge(n.children[i]) {
+		if d.isMerge(n.children[i]) {
 			d.merge(n.children[i+1], out)
 			continue
 		}
 		k := reflect.New(kt).Elem()
-		if d.unmarshal(n.children[i], k) {
-			kkind := k.Kind()
-			if kkind == reflect.Interface {
-				kkind = k.Elem().Kind()
+		kn := n.children[i]
+		terrlen := len(d.terrors)
+		d.mapKey, d.keyErr = resolveAlias(kn).kind == scalarNode, nil
+		good := d.unmarshal(kn, k)
+		d.mapKey = false
+		if !good {
+			if d.keyErr != nil {
+				d.terrorf(kn, "invalid map key `%s` for %s: %v", d.truncate(kn.value), kt, d.keyErr)
+				d.keyErr = nil
+			} else if kn.kind == scalarNode && len(d.terrors) > terrlen {
+				d.terrors = d.terrors[:terrlen]
+				d.terrorf(kn, "invalid map key `%s` for %s", d.truncate(kn.value), kt)
 			}
-			if kkind == reflect.Map || kkind == reflect.Slice {
-				failf("invalid map key: %#v", k.Interface())
-			}
-			e := reflect.New(et).Elem()
-			if d.unmarshal(n.children[i+1], e) {
-				d.setMapIndex(n.children[i+1], out, k, e)
+			continue
+		}
+		kkind := k.Kind()
+		if kkind == reflect.Interface {
+			kkind = k.Elem().Kind()
+		}
+		if kkind == reflect.Map || kkind == reflect.Slice {
+			failf("invalid map key: %#v", k.Interface())
+		}
+		if keyLines != nil && d.duplicate(keyLines, k.Interface(), n.children[i], "key %#v", k.Interface()) {
+			continue
+		}
+		e := reflect.New(et).Elem()
+		if set {
+			// Members of a set have no values, so a set decoded
+			// into a map of bools holds true for each of them.
+			if et.Kind() == reflect.Bool {
+				e.SetBool(true)
 			}
+			d.setMapIndex(n.children[i], out, k, e)
+		} else if d.unmarshal(n.children[i+1], e) {
+			d.setMapIndex(n.children[i+1], out, k, e)
 		}
 	}
 	d.mapType = mapType
 	return true
 }
 
+// setMembers reports an error for each member of the !!set mapping n
+// that has a value, and returns whether there were none.
+func (d *decoder) setMembers(n *node) (good bool) {
+	good = true
+	for i := 1; i < len(n.children); i += 2 {
+		if v := resolveAlias(n.children[i]); !isNull(v) {
+			d.terrorf(v, "!!set member %s must not have a value", d.truncate(n.children[i-1].value))
+			good = false
+		}
+	}
+	return good
+}
+
+// pairs decodes the !!omap or !!pairs sequence n, whose items must be
+// mappings with a single key, as the mapping of all their keys and
+// values in order. It returns handled as false if out is not a map,
+// a struct, a slice of MapItem or an interface, so that n is decoded
+// as a plain sequence.
+func (d *decoder) pairs(n *node, out reflect.Value) (good, handled bool) {
+	switch out.Kind() {
+	case reflect.Map, reflect.Struct, reflect.Interface:
+	case reflect.Slice:
+		if out.Type().Elem() != mapItemType {
+			return false, false
+		}
+	default:
+		return false, false
+	}
+	m := &node{kind: mappingNode, line: n.line, column: n.column}
+	for _, item := range n.children {
+		item = resolveAlias(item)
+		if item.kind != mappingNode || len(item.children) != 2 {
+			d.terrorf(item, "%s item must be a mapping with a single key", shortTag(n.tag))
+			return false, true
+		}
+		m.children = append(m.children, item.children...)
+	}
+	switch out.Kind() {
+	case reflect.Map, reflect.Struct:
+		return d.mapping(m, out), true
+	}
+	var items []MapItem
+	for i := 0; i < len(m.children); i += 2 {
+		var item MapItem
+		if d.unmarshal(m.children[i], reflect.ValueOf(&item.Key).Elem()) &&
+			d.unmarshal(m.children[i+1], reflect.ValueOf(&item.Value).Elem()) {
+			items = append(items, item)
+		}
+	}
+	if out.Kind() == reflect.Interface {
+		if n.tag == yaml_OMAP_TAG {
+			out.Set(reflect.ValueOf(Omap(items)))
+		} else {
+			out.Set(reflect.ValueOf(Pairs(items)))
+		}
+	} else {
+		out.Set(reflect.ValueOf(items).Convert(out.Type()))
+	}
+	return true, true
+}
+
 func (d *decoder) setMapIndex(n *node, out, k, v reflect.Value) {
-	if d.strict && out.MapIndex(k) != zeroValue {
-		d.terrors = append(d.terrors, fmt.Sprintf("line %d: key %#v already set in map", n.line+1, k.Interface()))
+	if d.dupPolicy() == DuplicateKeyError && out.MapIndex(k) != zeroValue {
+		d.terrorf(n, "key %#v already set in map", k.Interface())
 		return
 	}
 	out.SetMapIndex(k, v)
 }
 
+// dupPolicy returns the duplicate key policy in effect. Under
+// DuplicateKeyDefault the last value wins silently.
+func (d *decoder) dupPolicy() DuplicateKeyPolicy {
+	if d.duplicateKeys == DuplicateKeyDefault && d.strict {
+		return DuplicateKeyError
+	}
+	return d.duplicateKeys
+}
+
+// keyLines returns a map for recording the lines of the keys set in a
+// mapping if the duplicate key policy needs them, or nil otherwise.
+func (d *decoder) keyLines() map[interface{}]int {
+	switch d.dupPolicy() {
+	case DuplicateKeyFirstWins, DuplicateKeyLastWins:
+		return make(map[interface{}]int)
+	}
+	return nil
+}
+
+// duplicate records that key was set at n. If it was already set at an
+// earlier line, it reports a warning describing the key with format and
+// args, and returns whether the value at n must be ignored.
+func (d *decoder) duplicate(lines map[interface{}]int, key interface{}, n *node, format string, args ...interface{}) (ignore bool) {
+	prev, found := lines[key]
+	if !found {
+		lines[key] = n.line
+		return false
+	}
+	args = append(args, prev+1+d.lineOffset)
+	if d.dupPolicy() == DuplicateKeyFirstWins {
+		d.warnf(n, format+" already set at line %d; keeping the first value", args...)
+		return true
+	}
+	lines[key] = n.line
+	d.warnf(n, format+" already set at line %d; using the last value", args...)
+	return false
+}
+
 func (d *decoder) mappingSlice(n *node, out reflect.Value) (good bool) {
 	outt := out.Type()
 	if outt.Elem() != mapItemType {
@@ -703,7 +1724,7 @@ func (d *decoder) mappingSlice(n *node, out reflect.Value) (good bool) {
 	var slice []MapItem
 	var l = len(n.children)
 	for i := 0; i < l; i += 2 {
-		if isMerge(n.children[i]) {
+		if d.isMerge(n.children[i]) {
 			d.merge(n.children[i+1], out)
 			continue
 		}
@@ -722,63 +1743,178 @@ func (d *decoder) mappingSlice(n *node, out reflect.Value) (good bool) {
 }
 
 func (d *decoder) mappingStruct(n *node, out reflect.Value) (good bool) {
-	sinfo, err := getStructInfo(out.Type())
+	sinfo, err := getStructInfo(out.Type(), d.jsonTags, d.embedInline)
 	if err != nil {
-		panic(err)
+		fail(err)
 	}
 	name := settableValueOf("")
 	l := len(n.children)
 
 	var inlineMap reflect.Value
 	var elemType reflect.Type
-	if sinfo.InlineMap != -1 {
-		inlineMap = out.Field(sinfo.InlineMap)
+	if sinfo.InlineMap != nil {
+		inlineMap = out.FieldByIndex(sinfo.InlineMap)
 		inlineMap.Set(reflect.New(inlineMap.Type()).Elem())
 		elemType = inlineMap.Type().Elem()
 	}
 
 	var doneFields []bool
-	if d.strict {
+	if d.dupPolicy() == DuplicateKeyError {
 		doneFields = make([]bool, len(sinfo.FieldsList))
 	}
+	keyLines := d.keyLines()
+
+	// Fields set by a merge count as present in the mapping being
+	// merged into, so that mapping owns the missing field handling.
+	seenFields := d.mergedFields
+	d.mergedFields = nil
+	checkMissing := seenFields == nil && (sinfo.Required || sinfo.Defaults)
+	if checkMissing {
+		seenFields = make([]bool, len(sinfo.FieldsList))
+	}
 	for i := 0; i < l; i += 2 {
 		ni := n.children[i]
-		if isMerge(ni) {
+		if d.isMerge(ni) {
+			d.mergedFields = seenFields
 			d.merge(n.children[i+1], out)
+			d.mergedFields = nil
 			continue
 		}
 		if !d.unmarshal(ni, name) {
 			continue
 		}
-		if info, ok := sinfo.FieldsMap[name.String()]; ok {
-			if d.strict {
+		info, ok := sinfo.FieldsMap[name.String()]
+		if !ok && d.fieldCase != FieldCaseExact {
+			if finfo, found := sinfo.FoldedMap[strings.ToLower(name.String())]; found {
+				if d.fieldCase == FieldCaseStrict {
+					d.terrorf(ni, "field %s does not match the case of field %s in type %s", name.String(), finfo.Key, out.Type())
+					continue
+				}
+				d.warnf(ni, "field %s matched field %s in type %s ignoring case", name.String(), finfo.Key, out.Type())
+				info, ok = finfo, true
+			}
+		}
+		if ok {
+			if info.Key != name.String() && (d.fieldCase != FieldCaseFold || !strings.EqualFold(info.Key, name.String())) {
+				d.warnf(ni, "field %s is deprecated in type %s; use %s", name.String(), out.Type(), info.Key)
+			}
+			if doneFields != nil {
 				if doneFields[info.Id] {
-					d.terrors = append(d.terrors, fmt.Sprintf("line %d: field %s already set in type %s", ni.line+1, name.String(), out.Type()))
+					d.terrorf(ni, "field %s already set in type %s", name.String(), out.Type())
 					continue
 				}
 				doneFields[info.Id] = true
+			} else if keyLines != nil && d.duplicate(keyLines, info.Id, ni, "field %s in type %s", name.String(), out.Type()) {
+				continue
 			}
-			var field reflect.Value
-			if info.Inline == nil {
-				field = out.Field(info.Num)
-			} else {
-				field = out.FieldByIndex(info.Inline)
+			if seenFields != nil {
+				seenFields[info.Id] = true
 			}
-			d.unmarshal(n.children[i+1], field)
-		} else if sinfo.InlineMap != -1 {
+			d.field(n.children[i+1], info, fieldByInfo(out, info))
+		} else if sinfo.InlineMap != nil {
 			if inlineMap.IsNil() {
 				inlineMap.Set(reflect.MakeMap(inlineMap.Type()))
 			}
+			if keyLines != nil && d.duplicate(keyLines, name.String(), ni, "key %q", name.String()) {
+				continue
+			}
 			value := reflect.New(elemType).Elem()
 			d.unmarshal(n.children[i+1], value)
 			d.setMapIndex(n.children[i+1], inlineMap, name, value)
 		} else if d.strict {
-			d.terrors = append(d.terrors, fmt.Sprintf("line %d: field %s not found in type %s", ni.line+1, name.String(), out.Type()))
+			d.terrorf(ni, "field %s not found in type %s", name.String(), out.Type())
+		} else if d.warnUnknown {
+			d.warnf(ni, "field %s not found in type %s", name.String(), out.Type())
+		}
+	}
+	if checkMissing {
+		for _, info := range sinfo.FieldsList {
+			if seenFields[info.Id] {
+				continue
+			}
+			if info.Default != "" {
+				field := fieldByInfo(out, info)
+				if isZeroValue(field) {
+					d.field(relocated(info.DefaultNode, n.line, n.column), info, field)
+				}
+			} else if info.Required {
+				d.terrorf(n, "missing required field %s in type %s", info.Key, out.Type())
+			}
 		}
+	} else if seenFields != nil {
+		d.mergedFields = seenFields
+	}
+	if sinfo.PosField >= 0 {
+		out.Field(sinfo.PosField).Set(reflect.ValueOf(d.position(n)))
 	}
 	return true
 }
 
+// field decodes n into the struct field described by info, with the
+// settings of its tag flags.
+func (d *decoder) field(n *node, info fieldInfo, out reflect.Value) {
+	strict, timeFormat, exact, bytes := d.strict, d.timeFormat, d.exact, d.bytes
+	if info.Strict || info.Lenient {
+		d.strict = info.Strict
+	}
+	d.timeFormat = info.Format
+	d.exact = exact || info.Exact
+	if info.Bytes != 0 {
+		d.bytes = info.Bytes
+	}
+	d.unmarshal(n, out)
+	d.strict, d.timeFormat, d.exact, d.bytes = strict, timeFormat, exact, bytes
+}
+
+// relocated returns a copy of the tree of n with every node at the
+// given line and column, so that errors found while decoding the
+// default value of a field are reported at the mapping missing it.
+func relocated(n *node, line, column int) *node {
+	c := *n
+	c.line, c.column = line, column
+	if n.children != nil {
+		c.children = make([]*node, len(n.children))
+		for i, child := range n.children {
+			c.children[i] = relocated(child, line, column)
+		}
+	}
+	return &c
+}
+
+// parseDefault parses value, from the default tag flag of a field.
+func parseDefault(value string) (n *node, err error) {
+	defer handleErr(&err)
+	p := newParser([]byte(value))
+	defer p.destroy()
+	n = p.parse()
+	if n != nil && n.kind == documentNode {
+		n = n.children[0]
+	}
+	return n, nil
+}
+
+// checkDefault returns the errors found while decoding the default
+// value of the field described by info into a new value of type t.
+func checkDefault(info fieldInfo, t reflect.Type) (errs []string, err error) {
+	defer handleErr(&err)
+	d := newDecoder(defaultDecodeOptions)
+	d.field(info.DefaultNode, info, reflect.New(t).Elem())
+	return d.terrors, nil
+}
+
+// position returns the position of n in the input.
+func (d *decoder) position(n *node) Position {
+	return Position{Line: n.line + 1 + d.lineOffset, Column: n.column + 1 + d.columnOffset}
+}
+
+// fieldByInfo returns the field of the struct value v described by info.
+func fieldByInfo(v reflect.Value, info fieldInfo) reflect.Value {
+	if info.Inline == nil {
+		return v.Field(info.Num)
+	}
+	return v.FieldByIndex(info.Inline)
+}
+
 func failWantMap() {
 	failf("map merge requires map or sequence of maps as the value")
 }
@@ -813,3 +1949,140 @@ func (d *decoder) merge(n *node, out reflect.Value) {
 func isMerge(n *node) bool {
 	return n.kind == scalarNode && n.value == "<<" && (n.implicit == true || n.tag == yaml_MERGE_TAG)
 }
+
+// deepMerged returns a mapping node equivalent to n with its merge keys
+// replaced by the keys of the merged mappings, merging the values of
+// keys present on both sides recursively. Keys of n take precedence
+// over the merged keys, and earlier merged mappings take precedence
+// over later ones, as with ordinary merge keys.
+func (d *decoder) deepMerged(n *node) *node {
+	var sources []*node
+	for i := 0; i < len(n.children); i += 2 {
+		if !isMerge(n.children[i]) {
+			continue
+		}
+		v := n.children[i+1]
+		switch resolveAlias(v).kind {
+		case mappingNode:
+			sources = append(sources, v)
+		case sequenceNode:
+			for _, ni := range resolveAlias(v).children {
+				if resolveAlias(ni).kind != mappingNode {
+					failWantMap()
+				}
+				sources = append(sources, ni)
+			}
+		default:
+			failWantMap()
+		}
+	}
+	if sources == nil {
+		return n
+	}
+	var merged *node
+	for i := len(sources) - 1; i >= 0; i-- {
+		merged = d.overlay(merged, d.deepMergedAlias(sources[i]))
+	}
+	own := *n
+	own.children = nil
+	for i := 0; i < len(n.children); i += 2 {
+		if !isMerge(n.children[i]) {
+			own.children = append(own.children, n.children[i], n.children[i+1])
+		}
+	}
+	return d.overlay(merged, &own)
+}
+
+// deepMergedAlias returns deepMerged of the node n stands for. Like
+// alias, it fails if n is an alias whose value is being expanded
+// already, and counts the keys of the expanded mapping towards the
+// aliasing limits.
+func (d *decoder) deepMergedAlias(n *node) *node {
+	if n.kind != aliasNode || n.alias == nil {
+		return d.deepMerged(n)
+	}
+	if d.aliases[n] {
+		failf("anchor '%s' value contains itself", n.value)
+	}
+	d.aliases[n] = true
+	d.aliasCount += len(resolveAlias(n).children)/2 + 1
+	d.checkAliasing()
+	merged := d.deepMergedAlias(n.alias)
+	delete(d.aliases, n)
+	return merged
+}
+
+// overlay returns a mapping node holding the keys of base and over,
+// with the values of over taking precedence. Either may be nil.
+func (d *decoder) overlay(base, over *node) *node {
+	if base == nil {
+		return over
+	}
+	result := *over
+	result.children = nil
+	index := make(map[string]int)
+	for i := 0; i < len(base.children); i += 2 {
+		result.children = append(result.children, base.children[i], base.children[i+1])
+		if k := base.children[i]; k.kind == scalarNode {
+			index[k.value] = i
+		}
+	}
+	for i := 0; i < len(over.children); i += 2 {
+		k, v := over.children[i], over.children[i+1]
+		j, ok := index[k.value]
+		if k.kind != scalarNode || !ok {
+			result.children = append(result.children, k, v)
+			continue
+		}
+		result.children[j+1] = d.combine(k, result.children[j+1], v)
+	}
+	return &result
+}
+
+// combine returns the value of key k given its merged value base and
+// its overriding value over.
+func (d *decoder) combine(k, base, over *node) *node {
+	b, o := resolveAlias(base), resolveAlias(over)
+	switch {
+	case b.kind == mappingNode && o.kind == mappingNode:
+		return d.overlay(d.deepMergedAlias(base), d.deepMergedAlias(over))
+	case b.kind == sequenceNode && o.kind == sequenceNode && d.mergeMode == MergeDeepConcat:
+		result := *o
+		result.children = append(append([]*node(nil), b.children...), o.children...)
+		return &result
+	case b.kind != o.kind && !isNull(b) && !isNull(o):
+		d.warnf(k, "merged %s for key %s is overridden by a %s", kindName(b.kind), d.truncate(k.value), kindName(o.kind))
+	}
+	return over
+}
+
+func resolveAlias(n *node) *node {
+	for n.kind == aliasNode && n.alias != nil {
+		n = n.alias
+	}
+	return n
+}
+
+func isNull(n *node) bool {
+	if n.kind != scalarNode {
+		return false
+	}
+	tag, _ := resolve(n.tag, n.value)
+	return tag == yaml_NULL_TAG
+}
+
+func kindName(kind int) string {
+	switch kind {
+	case mappingNode:
+		return "mapping"
+	case sequenceNode:
+		return "sequence"
+	}
+	return "scalar"
+}
+
+// isMerge is like the isMerge function, but reports false for every
+// node when merge keys are disabled.
+func (d *decoder) isMerge(n *node) bool {
+	return !d.noMerge && isMerge(n)
+}
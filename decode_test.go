@@ -1,11 +1,17 @@
 package yaml_test
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"math"
+	"math/big"
+	"net"
+	"net/url"
 	"reflect"
 	"strings"
+	"testing/iotest"
 	"time"
 
 	. "gopkg.in/check.v1"
@@ -906,6 +912,86 @@ func (s *S) TestDecoderErrors(c *C) {
 	}
 }
 
+func (s *S) TestDecoderValueTruncation(c *C) {
+	data := "a: abcdefghijklmnop"
+	var v struct{ A int }
+	err := yaml.Unmarshal([]byte(data), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `abcdefg...` into int")
+
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetValueTruncation(6, "~")
+	err = dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `abcde~` into int")
+
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetValueTruncation(0, "")
+	err = dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `abcdefghijklmnop` into int")
+}
+
+func (s *S) TestDecoderSourceLines(c *C) {
+	var v struct{ A, B int }
+	dec := yaml.NewDecoder(strings.NewReader("a: 1\nb: foo\r\n"))
+	dec.SetSourceLines(true)
+	err := dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: cannot unmarshal !!str `foo` into int\n    \\| b: foo")
+
+	dec = yaml.NewDecoder(strings.NewReader("a: 1\nb: [c\n"))
+	dec.SetSourceLines(true)
+	err = dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: line 2: did not find expected ',' or ']'\n    \\| b: \\[c")
+}
+
+func (s *S) TestDecoderPositionOffset(c *C) {
+	var v struct{ A, B int }
+	dec := yaml.NewDecoder(strings.NewReader("a: 1\nb: foo\n"))
+	dec.SetPositionOffset(10, 0)
+	err := dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 12: cannot unmarshal !!str `foo` into int")
+
+	dec = yaml.NewDecoder(strings.NewReader("a: 1\nb: [c\n"))
+	dec.SetPositionOffset(10, 0)
+	dec.SetSourceLines(true)
+	err = dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: line 12: did not find expected ',' or ']'\n    \\| b: \\[c")
+
+	dec = yaml.NewDecoder(strings.NewReader("a:\n  b: 1\n\tc: 2\n"))
+	dec.SetPositionOffset(10, 4)
+	dec.SetFilename("page.md")
+	err = dec.Decode(&v)
+	c.Assert(err, ErrorMatches, `yaml: page.md:13: found a tab character that violates indentation \(replace the tab at column 5 with spaces\)`)
+}
+
+func (s *S) TestDecoderWithOptions(c *C) {
+	var v struct{ A int }
+	dec := yaml.NewDecoderWithOptions(strings.NewReader("a: 1\nb: 2\n"), yaml.WithStrict(true))
+	err := dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: field b not found in type struct { A int }")
+
+	var i interface{}
+	dec = yaml.NewDecoderWithOptions(strings.NewReader("a: [[1]]\n"), yaml.WithMaxDepth(2))
+	err = dec.Decode(&i)
+	c.Assert(err, ErrorMatches, "yaml: exceeded max depth of 2")
+
+	dec = yaml.NewDecoderWithOptions(strings.NewReader("a: [1]\n"), yaml.WithMaxDepth(2))
+	err = dec.Decode(&i)
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestDecodeContext(c *C) {
+	data := strings.Repeat("- a\n", 1000)
+	var v []string
+	err := yaml.NewDecoder(strings.NewReader(data)).DecodeContext(context.Background(), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v, HasLen, 1000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	v = nil
+	err = yaml.NewDecoder(strings.NewReader(data)).DecodeContext(ctx, &v)
+	c.Assert(err, Equals, context.Canceled)
+}
+
 var unmarshalerTests = []struct {
 	data, tag string
 	value     interface{}
@@ -1207,6 +1293,13 @@ func (s *S) TestUnmarshalNull(c *C) {
 			c.Assert(reflect.ValueOf(item).Elem().Interface(), DeepEquals, zero)
 		}
 	}
+
+	var v map[string]interface{}
+	err := yaml.Unmarshal([]byte("a: !!null {a: 1}\nb: !!null [1]\nc: !!null\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: cannot unmarshal a mapping with tag !!null\n"+
+		"  line 2: cannot unmarshal a sequence with tag !!null")
+	c.Assert(v, DeepEquals, map[string]interface{}{"c": nil})
 }
 
 func (s *S) TestUnmarshalSliceOnPreset(c *C) {
@@ -1299,6 +1392,1459 @@ func (s *S) TestUnmarshalStrict(c *C) {
 	}
 }
 
+func (s *S) TestUnmarshalRequired(c *C) {
+	type Inner struct {
+		C int `yaml:"c,required"`
+	}
+	type T struct {
+		A     int `yaml:"a,required"`
+		B     int `yaml:"b,required"`
+		Inner `yaml:",inline"`
+	}
+	var v T
+	err := yaml.Unmarshal([]byte("x: 1\nb: 2\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: missing required field a in type yaml_test.T\n"+
+		"  line 1: missing required field c in type yaml_test.T")
+	c.Assert(v.B, Equals, 2)
+
+	err = yaml.Unmarshal([]byte("base: &base {a: 1, c: 3}\nt:\n  <<: *base\n  b: 2\n"), &struct{ T T }{})
+	c.Assert(err, IsNil)
+
+	err = yaml.Unmarshal([]byte("t:\n  <<: [{a: 1}, {c: 3}]\n"), &struct{ T T }{})
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: missing required field b in type yaml_test.T")
+}
+
+func (s *S) TestUnmarshalDefault(c *C) {
+	type T struct {
+		Host  string        `yaml:"host,default=localhost"`
+		Port  int           `yaml:"port,required,default=8080"`
+		Debug bool          `yaml:"debug,default=true"`
+		Wait  time.Duration `yaml:"wait,default=1m"`
+	}
+	var v T
+	err := yaml.Unmarshal([]byte("host: example.com\ndebug: false\n"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v, Equals, T{Host: "example.com", Port: 8080, Debug: false, Wait: time.Minute})
+
+	v = T{Host: "db", Port: 5432}
+	err = yaml.Unmarshal([]byte("debug: false\n"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v, Equals, T{Host: "db", Port: 5432, Debug: false, Wait: time.Minute})
+
+	type Lists struct {
+		Tags  []string       `yaml:"tags,default=[a]"`
+		Rates map[string]int `yaml:"rates,default={x: 1}"`
+	}
+	var l Lists
+	c.Assert(yaml.Unmarshal([]byte("{}"), &l), IsNil)
+	c.Assert(l, DeepEquals, Lists{[]string{"a"}, map[string]int{"x": 1}})
+
+	type Bad struct {
+		Port int `yaml:"port,default=http"`
+	}
+	err = yaml.Unmarshal([]byte("port: 1"), &Bad{})
+	c.Assert(err, DeepEquals, &yaml.StructError{
+		Type: reflect.TypeOf(Bad{}),
+		Key:  "port",
+		Msg:  "Invalid default \"http\" for field port of type yaml_test.Bad: cannot unmarshal !!str `http` into int",
+	})
+
+	type Unparsable struct {
+		Tags []string `yaml:"tags,default=[a"`
+	}
+	err = yaml.Unmarshal([]byte("{}"), &Unparsable{})
+	c.Assert(err, ErrorMatches, `Invalid default in tag "tags,default=\[a" of type yaml_test.Unparsable: line 1: did not find expected ',' or '\]'`)
+}
+
+func (s *S) TestDecoderFieldCase(c *C) {
+	type T struct {
+		Name  string
+		Other string `yaml:"Other"`
+	}
+	data := "Name: a\nother: b\n"
+
+	var v T
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, Equals, T{})
+
+	v = T{}
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetFieldCase(yaml.FieldCaseStrict)
+	err := dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: field Name does not match the case of field name in type yaml_test.T\n"+
+		"  line 2: field other does not match the case of field Other in type yaml_test.T")
+
+	v = T{}
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetFieldCase(yaml.FieldCaseFold)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, Equals, T{Name: "a", Other: "b"})
+	c.Assert(dec.Warnings(), DeepEquals, []string{
+		"line 1: field Name matched field name in type yaml_test.T ignoring case",
+		"line 2: field other matched field Other in type yaml_test.T ignoring case",
+	})
+}
+
+func (s *S) TestDecoderFieldAliases(c *C) {
+	type T struct {
+		Endpoint string `yaml:"endpoint,alias=url,alias=address"`
+	}
+	var v T
+	dec := yaml.NewDecoder(strings.NewReader("url: http://example.com\n"))
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.Endpoint, Equals, "http://example.com")
+	c.Assert(dec.Warnings(), DeepEquals, []string{
+		"line 1: field url is deprecated in type yaml_test.T; use endpoint",
+	})
+
+	v = T{}
+	dec = yaml.NewDecoder(strings.NewReader("endpoint: a\naddress: b\n"))
+	dec.SetStrict(true)
+	err := dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: field address already set in type yaml_test.T")
+
+	data, err := yaml.Marshal(T{"x"})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "endpoint: x\n")
+
+	type Conflict struct {
+		A string `yaml:"a,alias=b"`
+		B string
+	}
+	_, err = yaml.Marshal(Conflict{})
+	c.Assert(err, ErrorMatches, "Duplicated key 'b' in struct yaml_test.Conflict")
+}
+
+func (s *S) TestUnmarshalStrictInlineMap(c *C) {
+	type T struct {
+		Name  string
+		Extra map[string]interface{} `yaml:",inline"`
+	}
+	var v T
+	err := yaml.UnmarshalStrict([]byte("name: a\nb: 1\nc: [2]\n"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, T{
+		Name:  "a",
+		Extra: map[string]interface{}{"b": 1, "c": []interface{}{2}},
+	})
+}
+
+func (s *S) TestUnmarshalFieldStrictness(c *C) {
+	type Inner struct{ A int }
+	type T struct {
+		Open   Inner `yaml:"open,lenient"`
+		Closed Inner `yaml:"closed,strict"`
+	}
+	data := "open: {a: 1, b: 2}\nclosed: {a: 1, c: 3}\n"
+
+	var v T
+	err := yaml.Unmarshal([]byte(data), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: field c not found in type yaml_test.Inner")
+	c.Assert(v, Equals, T{Inner{1}, Inner{1}})
+
+	v = T{}
+	err = yaml.UnmarshalStrict([]byte(data), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: field c not found in type yaml_test.Inner")
+}
+
+func (s *S) TestDecoderDuplicateKeyPolicy(c *C) {
+	type T struct {
+		A     int
+		Extra map[string]int `yaml:",inline"`
+	}
+	data := "a: 1\nb: 2\na: 3\nb: 4\n"
+
+	var v T
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetDuplicateKeyPolicy(yaml.DuplicateKeyError)
+	err := dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 3: field a already set in type yaml_test.T\n"+
+		"  line 4: key \"b\" already set in map")
+
+	v = T{}
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetStrict(true)
+	dec.SetDuplicateKeyPolicy(yaml.DuplicateKeyFirstWins)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, T{A: 1, Extra: map[string]int{"b": 2}})
+	c.Assert(dec.Warnings(), DeepEquals, []string{
+		"line 3: field a in type yaml_test.T already set at line 1; keeping the first value",
+		"line 4: key \"b\" already set at line 2; keeping the first value",
+	})
+
+	var m map[string]int
+	dec = yaml.NewDecoderWithOptions(strings.NewReader(data), yaml.WithDuplicateKeyPolicy(yaml.DuplicateKeyLastWins))
+	c.Assert(dec.Decode(&m), IsNil)
+	c.Assert(m, DeepEquals, map[string]int{"a": 3, "b": 4})
+	c.Assert(dec.Warnings(), DeepEquals, []string{
+		"line 3: key \"a\" already set at line 1; using the last value",
+		"line 4: key \"b\" already set at line 2; using the last value",
+	})
+}
+
+func (s *S) TestDecoderStrictScalars(c *C) {
+	type T struct {
+		A bool
+		B int
+		C interface{}
+		D interface{}
+		E bool
+	}
+	dec := yaml.NewDecoder(strings.NewReader("a: yes\nb: 1.0\nc: 0755\nd: on\ne: !!bool yes\n"))
+	dec.SetStrictScalars(true)
+	var v T
+	err := dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: cannot unmarshal !!str `yes` into bool\n"+
+		"  line 2: cannot unmarshal !!float `1.0` into int")
+	c.Assert(v, DeepEquals, T{C: "0755", D: "on", E: true})
+
+	dec = yaml.NewDecoder(strings.NewReader("a: TRUE\nb: 0x1F\nc: 0\nd: -12\n"))
+	dec.SetStrictScalars(true)
+	v = T{}
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, T{A: true, B: 31, C: 0, D: -12})
+}
+
+func (s *S) TestDecoderSchemaCore(c *C) {
+	dec := yaml.NewDecoder(strings.NewReader("a: yes\nb: 0755\nc: 0o17\nd: 1_000\ne: 1:20\nf: 0b101\ng: True\nh: .inf\ni: 1e3\nj: 0x1F\n"))
+	dec.SetSchema(yaml.SchemaCore)
+	var v map[string]interface{}
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{
+		"a": "yes",
+		"b": 755,
+		"c": 15,
+		"d": "1_000",
+		"e": "1:20",
+		"f": "0b101",
+		"g": true,
+		"h": math.Inf(1),
+		"i": 1e3,
+		"j": 31,
+	})
+
+	dec = yaml.NewDecoder(strings.NewReader("a: !!bool yes\n"))
+	dec.SetSchema(yaml.SchemaCore)
+	v = nil
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{"a": true})
+}
+
+func (s *S) TestDecoderDisableMergeKeys(c *C) {
+	data := "a: &a {x: 1}\nb:\n  <<: *a\n  z: 2\n"
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.DisableMergeKeys()
+	var v map[string]interface{}
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v["b"], DeepEquals, map[interface{}]interface{}{
+		"<<": map[interface{}]interface{}{"x": 1},
+		"z":  2,
+	})
+
+	var t struct {
+		Merge string "<<"
+	}
+	dec = yaml.NewDecoder(strings.NewReader("<<: base\n"))
+	dec.DisableMergeKeys()
+	c.Assert(dec.Decode(&t), IsNil)
+	c.Assert(t.Merge, Equals, "base")
+}
+
+func (s *S) TestDecoderMergeMode(c *C) {
+	data := `
+base: &base
+  server: {host: localhost, port: 80}
+  tags: [a]
+  name: {first: x}
+service:
+  <<: *base
+  server: {port: 8080}
+  tags: [b]
+  name: plain
+`
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetMergeMode(yaml.MergeDeep)
+	var v map[string]map[string]interface{}
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v["service"], DeepEquals, map[string]interface{}{
+		"server": map[interface{}]interface{}{"host": "localhost", "port": 8080},
+		"tags":   []interface{}{"b"},
+		"name":   "plain",
+	})
+	c.Assert(dec.Warnings(), DeepEquals, []string{
+		"line 10: merged mapping for key name is overridden by a scalar",
+	})
+
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetMergeMode(yaml.MergeDeepConcat)
+	v = nil
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v["service"]["tags"], DeepEquals, []interface{}{"a", "b"})
+
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	v = nil
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v["service"]["server"], DeepEquals, map[interface{}]interface{}{"port": 8080})
+}
+
+func (s *S) TestDecoderDeepMergeSelf(c *C) {
+	for _, mode := range []yaml.MergeMode{yaml.MergeShallow, yaml.MergeDeep, yaml.MergeDeepConcat} {
+		dec := yaml.NewDecoder(strings.NewReader("a: &a {b: 1, <<: *a}\n"))
+		dec.SetMergeMode(mode)
+		var v interface{}
+		c.Assert(dec.Decode(&v), ErrorMatches, "yaml: anchor 'a' value contains itself")
+	}
+}
+
+func (s *S) TestDecoderUseNumber(c *C) {
+	dec := yaml.NewDecoder(strings.NewReader("a: 12\nb: 1.50\nc: 123456789012345678901234567890\nd: text\ne: 0x1F\n"))
+	dec.UseNumber()
+	var v map[string]interface{}
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{
+		"a": yaml.Number("12"),
+		"b": yaml.Number("1.50"),
+		"c": yaml.Number("123456789012345678901234567890"),
+		"d": "text",
+		"e": yaml.Number("0x1F"),
+	})
+
+	i, err := v["e"].(yaml.Number).Int64()
+	c.Assert(err, IsNil)
+	c.Assert(i, Equals, int64(31))
+	f, err := v["b"].(yaml.Number).Float64()
+	c.Assert(err, IsNil)
+	c.Assert(f, Equals, 1.5)
+	_, err = v["b"].(yaml.Number).Int64()
+	c.Assert(err, ErrorMatches, `yaml: cannot convert number "1.50" to int64`)
+
+	data, err := yaml.Marshal(v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: 12\nb: 1.50\nc: 123456789012345678901234567890\nd: text\ne: 0x1F\n")
+}
+
+func (s *S) TestDecoderUseInt64(c *C) {
+	dec := yaml.NewDecoder(strings.NewReader("a: 12\nb: 18446744073709551615\nc: -123456789012345678901234567890\nd: 0x1_0000_0000_0000_0000\ne: 1.5\nf: !!int 7\n"))
+	dec.UseInt64()
+	var v map[string]interface{}
+	c.Assert(dec.Decode(&v), IsNil)
+	neg, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	c.Assert(v, DeepEquals, map[string]interface{}{
+		"a": int64(12),
+		"b": uint64(18446744073709551615),
+		"c": neg,
+		"d": new(big.Int).Lsh(big.NewInt(1), 64),
+		"e": 1.5,
+		"f": int64(7),
+	})
+}
+
+func (s *S) TestUnmarshalDuration(c *C) {
+	var v struct {
+		A, B time.Duration
+	}
+	err := yaml.Unmarshal([]byte("a: 1h15m\nb: 30 seconds\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: invalid duration `30 seco...` for time.Duration")
+	c.Assert(v.A, Equals, time.Hour+15*time.Minute)
+}
+
+func (s *S) TestUnmarshalTimeFormat(c *C) {
+	var v struct {
+		Created time.Time  `yaml:"created,format=02/01/2006"`
+		Updated *time.Time `yaml:"updated,format=2006-01-02 15:04"`
+		Seen    time.Time  `yaml:"seen"`
+	}
+	err := yaml.Unmarshal([]byte("created: 14/10/2026\nupdated: 2026-10-14 09:30\nseen: 2026-10-14\n"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v.Created, Equals, time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC))
+	c.Assert(*v.Updated, Equals, time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC))
+	c.Assert(v.Seen, Equals, time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC))
+
+	err = yaml.Unmarshal([]byte("created: 2026-10-14\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot parse `2026-10-14` as time.Time using layout \"02/01/2006\"")
+}
+
+func (s *S) TestDecoderTimeLayouts(c *C) {
+	var v map[string]time.Time
+	dec := yaml.NewDecoder(strings.NewReader("a: 2026-10-14\nb: Oct 14 2026\nc: 14.10.2026\nd: never\n"))
+	dec.SetTimeLayouts("Jan 2 2006", "02.01.2006")
+	err := dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 4: cannot parse `never` as time.Time using layouts \"Jan 2 2006\", \"02.01.2006\"")
+	day := time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC)
+	c.Assert(v, DeepEquals, map[string]time.Time{"a": day, "b": day, "c": day})
+}
+
+func (s *S) TestUnmarshalAddresses(c *C) {
+	var v struct {
+		IP  net.IP
+		Net net.IPNet
+		Ptr *net.IPNet
+	}
+	err := yaml.Unmarshal([]byte("ip: 10.1.2.3\nnet: 10.1.0.0/16\nptr: 2001:db8::/32\n"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v.IP, DeepEquals, net.ParseIP("10.1.2.3"))
+	c.Assert(v.Net.String(), Equals, "10.1.0.0/16")
+	c.Assert(v.Ptr.String(), Equals, "2001:db8::/32")
+
+	data, err := yaml.Marshal(&v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "ip: 10.1.2.3\nnet: 10.1.0.0/16\nptr: 2001:db8::/32\n")
+
+	err = yaml.Unmarshal([]byte("ip: 300.1.2.3\nnet: 10.1.0.0\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: invalid address `300.1.2.3` for net.IP\n"+
+		"  line 2: invalid address `10.1.0.0` for net.IPNet")
+}
+
+func (s *S) TestUnmarshalURL(c *C) {
+	var v struct {
+		Home url.URL
+		API  *url.URL
+	}
+	err := yaml.Unmarshal([]byte("home: https://example.com/a?b=c\napi: /v1/items\n"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v.Home.Host, Equals, "example.com")
+	c.Assert(v.API.Path, Equals, "/v1/items")
+
+	data, err := yaml.Marshal(&v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "home: https://example.com/a?b=c\napi: /v1/items\n")
+
+	err = yaml.Unmarshal([]byte("home: ok\napi: \"http://[::1\"\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: invalid URL `http://...` for url.URL")
+}
+
+func (s *S) TestUnmarshalBigNumbers(c *C) {
+	var v struct {
+		I big.Int
+		P *big.Int
+		F *big.Float
+		R big.Rat
+	}
+	data := "i: 123456789012345678901234567890\np: 0x1_0000\nf: 3.14159265358979323846264338327950288\nr: 1/3\n"
+	c.Assert(yaml.Unmarshal([]byte(data), &v), IsNil)
+	c.Assert(v.I.String(), Equals, "123456789012345678901234567890")
+	c.Assert(v.P.Int64(), Equals, int64(65536))
+	c.Assert(v.F.Text('g', -1), Equals, "3.14159265358979323846264338327950288")
+	c.Assert(v.R.RatString(), Equals, "1/3")
+
+	out, err := yaml.Marshal(&v)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "i: 123456789012345678901234567890\np: 65536\nf: 3.14159265358979323846264338327950288\nr: 1/3\n")
+
+	err = yaml.Unmarshal([]byte("i: 1.5\nr: half\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: cannot unmarshal !!float `1.5` into big.Int\n"+
+		"  line 2: cannot unmarshal !!str `half` into big.Rat")
+}
+
+type userID struct {
+	n int
+}
+
+func (id *userID) UnmarshalText(text []byte) error {
+	if !strings.HasPrefix(string(text), "u") {
+		return errors.New("user IDs start with u")
+	}
+	_, err := fmt.Sscan(string(text[1:]), &id.n)
+	return err
+}
+
+func (s *S) TestUnmarshalTextUnmarshalerMapKeys(c *C) {
+	var v map[userID]string
+	err := yaml.Unmarshal([]byte("u1: alice\nu2: bob\n"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, map[userID]string{{1}: "alice", {2}: "bob"})
+
+	v = nil
+	err = yaml.Unmarshal([]byte("u1: alice\n7: bob\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: invalid map key `7` for yaml_test.userID: user IDs start with u")
+	c.Assert(v, DeepEquals, map[userID]string{{1}: "alice"})
+
+	var times map[time.Time]string
+	err = yaml.Unmarshal([]byte("2001-12-14: release\n"), &times)
+	c.Assert(err, IsNil)
+	c.Assert(times, DeepEquals, map[time.Time]string{time.Date(2001, 12, 14, 0, 0, 0, 0, time.UTC): "release"})
+}
+
+type ctxKey struct{}
+
+type contextUnmarshaler struct {
+	Value  string
+	Prefix string
+}
+
+func (u *contextUnmarshaler) UnmarshalYAMLContext(ctx context.Context, unmarshal func(interface{}) error) error {
+	u.Prefix, _ = ctx.Value(ctxKey{}).(string)
+	return unmarshal(&u.Value)
+}
+
+func (u *contextUnmarshaler) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	panic("UnmarshalYAML called instead of UnmarshalYAMLContext")
+}
+
+func (s *S) TestContextUnmarshaler(c *C) {
+	var v map[string]*contextUnmarshaler
+	ctx := context.WithValue(context.Background(), ctxKey{}, "env")
+	dec := yaml.NewDecoder(strings.NewReader("a: x\nb: [y]\n"))
+	err := dec.DecodeContext(ctx, &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: cannot unmarshal !!seq into string")
+	c.Assert(v["a"], DeepEquals, &contextUnmarshaler{"x", "env"})
+
+	v = nil
+	c.Assert(yaml.Unmarshal([]byte("a: x\n"), &v), IsNil)
+	c.Assert(v["a"], DeepEquals, &contextUnmarshaler{"x", ""})
+}
+
+type color int
+
+func colorHook(to reflect.Type, unmarshal func(interface{}) error) (interface{}, bool, error) {
+	if to != reflect.TypeOf(color(0)) {
+		return nil, false, nil
+	}
+	var name string
+	if err := unmarshal(&name); err != nil {
+		return nil, true, err
+	}
+	switch name {
+	case "red":
+		return 1, true, nil
+	case "green":
+		return color(2), true, nil
+	}
+	return nil, true, fmt.Errorf("unknown color %q", name)
+}
+
+func (s *S) TestDecoderDecodeHook(c *C) {
+	var v struct {
+		A color
+		B *color
+		C []color
+		D int
+	}
+	dec := yaml.NewDecoder(strings.NewReader("a: red\nb: green\nc: [green, red]\nd: 3\n"))
+	dec.SetDecodeHook(colorHook)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.A, Equals, color(1))
+	c.Assert(*v.B, Equals, color(2))
+	c.Assert(v.C, DeepEquals, []color{2, 1})
+	c.Assert(v.D, Equals, 3)
+
+	dec = yaml.NewDecoder(strings.NewReader("a: [red]\n"))
+	dec.SetDecodeHook(colorHook)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!seq into string")
+
+	dec = yaml.NewDecoder(strings.NewReader("a: blue\n"))
+	dec.SetDecodeHook(colorHook)
+	c.Assert(dec.Decode(&v), ErrorMatches, `unknown color "blue"`)
+}
+
+type validatedPort struct {
+	Host string
+	Port int
+}
+
+func (p *validatedPort) ValidateYAML() error {
+	if p.Port <= 0 {
+		return errors.New("port must be positive")
+	}
+	return nil
+}
+
+func (s *S) TestUnmarshalValidator(c *C) {
+	var v []validatedPort
+	err := yaml.Unmarshal([]byte("- {host: a, port: 80}\n- {host: b, port: 0}\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: invalid yaml_test.validatedPort: port must be positive")
+	c.Assert(v, DeepEquals, []validatedPort{{"a", 80}, {"b", 0}})
+
+	dec := yaml.NewDecoder(strings.NewReader("- {host: a, port: 80}\n-\n  host: \"\"\n  port: 81\n"))
+	dec.SetValidator(func(v interface{}) error {
+		if p, ok := v.(*validatedPort); ok && p.Host == "" {
+			return errors.New("missing host")
+		}
+		return nil
+	})
+	v = nil
+	err = dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 3: invalid yaml_test.validatedPort: missing host")
+}
+
+func (s *S) TestUnmarshalPosition(c *C) {
+	type Service struct {
+		Name string
+		Pos  yaml.Position `yaml:",pos"`
+	}
+	var v struct {
+		Services []Service
+	}
+	data := "services:\n- name: a\n-   name: b\n"
+	c.Assert(yaml.Unmarshal([]byte(data), &v), IsNil)
+	c.Assert(v.Services, DeepEquals, []Service{
+		{"a", yaml.Position{Line: 2, Column: 3}},
+		{"b", yaml.Position{Line: 3, Column: 5}},
+	})
+
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetPositionOffset(10, 0)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.Services[1].Pos, Equals, yaml.Position{Line: 13, Column: 5})
+
+	out, err := yaml.Marshal(&v)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "services:\n- name: a\n- name: b\n")
+
+	var bad struct {
+		Pos int `yaml:",pos"`
+	}
+	c.Assert(yaml.Unmarshal([]byte("a: 1"), &bad), ErrorMatches, "Option ,pos needs a yaml.Position field in struct .*")
+}
+
+func (s *S) TestDecoderSeq(c *C) {
+	dec := yaml.NewDecoder(strings.NewReader("- {id: 1, name: &n a}\n- {id: 2, name: *n}\n- {id: x}\n---\nnext: doc\n"))
+	seq := dec.Seq()
+	type item struct {
+		ID   int
+		Name string
+	}
+	var items []item
+	var errs []string
+	for seq.Next() {
+		var it item
+		if err := seq.Decode(&it); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		items = append(items, it)
+	}
+	c.Assert(seq.Err(), IsNil)
+	c.Assert(items, DeepEquals, []item{{1, "a"}, {2, "a"}})
+	c.Assert(errs, DeepEquals, []string{"yaml: unmarshal errors:\n  line 3: cannot unmarshal !!str `x` into int"})
+
+	var next map[string]string
+	c.Assert(dec.Decode(&next), IsNil)
+	c.Assert(next, DeepEquals, map[string]string{"next": "doc"})
+
+	seq = yaml.NewDecoder(strings.NewReader("a: 1\n")).Seq()
+	c.Assert(seq.Next(), Equals, false)
+	c.Assert(seq.Err(), ErrorMatches, "yaml: line 1: document does not hold a sequence")
+
+	seq = yaml.NewDecoder(strings.NewReader("")).Seq()
+	c.Assert(seq.Next(), Equals, false)
+	c.Assert(seq.Err(), Equals, io.EOF)
+}
+
+func (s *S) TestDecoderMore(c *C) {
+	dec := yaml.NewDecoder(strings.NewReader("a: 1\n---\na: 2\n"))
+	var values []int
+	for dec.More() {
+		var v struct{ A int }
+		c.Assert(dec.Decode(&v), IsNil)
+		values = append(values, v.A)
+	}
+	c.Assert(values, DeepEquals, []int{1, 2})
+	c.Assert(dec.More(), Equals, false)
+
+	c.Assert(yaml.NewDecoder(strings.NewReader("")).More(), Equals, false)
+
+	dec = yaml.NewDecoder(strings.NewReader("a: 1\n--- : [\n"))
+	var v interface{}
+	c.Assert(dec.More(), Equals, true)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(dec.More(), Equals, true)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: line .*")
+}
+
+func (s *S) TestParserEvents(c *C) {
+	p := yaml.NewParser(strings.NewReader("a: &x 'b'\nc: [*x, !!int 1]\n"))
+	var events []yaml.Event
+	for {
+		ev, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		events = append(events, ev)
+	}
+	var types []yaml.EventType
+	for _, ev := range events {
+		types = append(types, ev.Type)
+	}
+	c.Assert(types, DeepEquals, []yaml.EventType{
+		yaml.StreamStartEvent, yaml.DocumentStartEvent, yaml.MappingStartEvent,
+		yaml.ScalarEvent, yaml.ScalarEvent,
+		yaml.ScalarEvent, yaml.SequenceStartEvent, yaml.AliasEvent, yaml.ScalarEvent, yaml.SequenceEndEvent,
+		yaml.MappingEndEvent, yaml.DocumentEndEvent, yaml.StreamEndEvent,
+	})
+	c.Assert(events[4], DeepEquals, yaml.Event{
+		Type:   yaml.ScalarEvent,
+		Start:  yaml.Position{Line: 1, Column: 4},
+		End:    yaml.Position{Line: 1, Column: 10},
+		Anchor: "x",
+		Value:  "b",
+		Style:  yaml.SingleQuotedStyle,
+	})
+	c.Assert(events[6].Style, Equals, yaml.FlowStyle)
+	c.Assert(events[7].Anchor, Equals, "x")
+	c.Assert(events[8].Tag, Equals, "!!int")
+	c.Assert(events[2].Type.String(), Equals, "mapping start")
+
+	p = yaml.NewParser(strings.NewReader("a: [b\n"))
+	var err error
+	for err == nil {
+		_, err = p.Next()
+	}
+	c.Assert(err, ErrorMatches, "yaml: line 1: did not find expected ',' or ']'")
+}
+
+func (s *S) TestUnmarshalAll(c *C) {
+	type T struct{ A int }
+	var v []T
+	err := yaml.UnmarshalAll([]byte("a: 1\n---\na: x\n---\na: 3\n---\na: [4]\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  document 2: line 3: cannot unmarshal !!str `x` into int\n"+
+		"  document 4: line 7: cannot unmarshal !!seq into int")
+	c.Assert(v, DeepEquals, []T{{1}, {0}, {3}, {0}})
+
+	var m []map[string]int
+	dec := yaml.NewDecoder(strings.NewReader("a: 1\na: 2\n---\nb: 3\n"))
+	dec.SetDuplicateKeyPolicy(yaml.DuplicateKeyLastWins)
+	c.Assert(dec.DecodeAll(&m), IsNil)
+	c.Assert(m, DeepEquals, []map[string]int{{"a": 2}, {"b": 3}})
+	c.Assert(dec.Warnings(), DeepEquals, []string{"document 1: line 2: key \"a\" already set at line 1; using the last value"})
+
+	c.Assert(yaml.UnmarshalAll([]byte("a: 1"), &T{}), ErrorMatches, `yaml: DecodeAll needs a pointer to a slice, not \*yaml_test.T`)
+}
+
+func (s *S) TestUnmarshalFrontMatter(c *C) {
+	var v struct {
+		Title string
+		Tags  []string
+	}
+	doc := "---\ntitle: Hello\ntags: [a, b]\n---\n# Hello\n\nText.\n"
+	rest, err := yaml.UnmarshalFrontMatter([]byte(doc), &v)
+	c.Assert(err, IsNil)
+	c.Assert(string(rest), Equals, "# Hello\n\nText.\n")
+	c.Assert(v.Title, Equals, "Hello")
+	c.Assert(v.Tags, DeepEquals, []string{"a", "b"})
+
+	rest, err = yaml.UnmarshalFrontMatter([]byte("# No front matter\n"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(string(rest), Equals, "# No front matter\n")
+
+	rest, err = yaml.UnmarshalFrontMatter([]byte("---\r\n...\r\nbody"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(string(rest), Equals, "body")
+
+	_, err = yaml.UnmarshalFrontMatter([]byte("---\ntitle: a\ntags: b\n---\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 3: cannot unmarshal !!str `b` into \\[\\]string")
+
+	_, err = yaml.UnmarshalFrontMatter([]byte("---\ntitle: a\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: front matter is not terminated")
+}
+
+func (s *S) TestDecoderRegisterTag(c *C) {
+	env := map[string]string{"HOME": "/home/gopher", "PORT": "8080"}
+	var v struct {
+		Home string
+		Port int
+		Path *string
+		Any  interface{}
+	}
+	dec := yaml.NewDecoder(strings.NewReader("home: !env HOME\nport: !env PORT\npath: !env HOME\nany: !env [HOME, PORT]\n"))
+	dec.RegisterTag("!env", func(unmarshal func(interface{}) error) (interface{}, error) {
+		var names []string
+		if err := unmarshal(&names); err == nil {
+			var values []string
+			for _, name := range names {
+				values = append(values, env[name])
+			}
+			return strings.Join(values, ":"), nil
+		}
+		var name string
+		if err := unmarshal(&name); err != nil {
+			return nil, err
+		}
+		value, ok := env[name]
+		if !ok {
+			return nil, fmt.Errorf("%s is not set", name)
+		}
+		return value, nil
+	})
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: unmarshal errors:\n  line 2: !env constructor returned string for int")
+	c.Assert(v.Home, Equals, "/home/gopher")
+	c.Assert(*v.Path, Equals, "/home/gopher")
+	c.Assert(v.Any, Equals, "/home/gopher:8080")
+
+	dec = yaml.NewDecoder(strings.NewReader("home: !env USER\n"))
+	dec.RegisterTag("!env", func(unmarshal func(interface{}) error) (interface{}, error) {
+		return nil, errors.New("USER is not set")
+	})
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot construct !env value: USER is not set")
+}
+
+func (s *S) TestDecoderInclude(c *C) {
+	files := map[string]string{
+		"db.yaml":    "host: localhost\nport: 5432\n",
+		"bad.yaml":   "host: x\nport: none\n",
+		"loop.yaml":  "db: !include loop2.yaml\n",
+		"loop2.yaml": "!include loop.yaml\n",
+		"deep.yaml":  "a: {b: {c: 1}}\n",
+	}
+	resolver := yaml.IncludeResolverFunc(func(name string) ([]byte, error) {
+		data, ok := files[name]
+		if !ok {
+			return nil, errors.New("file not found")
+		}
+		return []byte(data), nil
+	})
+	type DB struct {
+		Host string
+		Port int
+	}
+	var v map[string]DB
+	dec := yaml.NewDecoder(strings.NewReader("main: !include db.yaml\n"))
+	dec.SetIncludeResolver(resolver)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]DB{"main": {"localhost", 5432}})
+
+	dec = yaml.NewDecoder(strings.NewReader("a: !include bad.yaml\nb: !include missing.yaml\n"))
+	dec.SetIncludeResolver(resolver)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: in bad.yaml: line 2: cannot unmarshal !!str `none` into int\n"+
+		"  line 2: cannot include missing.yaml: file not found")
+
+	var w map[string]interface{}
+	dec = yaml.NewDecoder(strings.NewReader("!include loop.yaml\n"))
+	dec.SetIncludeResolver(resolver)
+	c.Assert(dec.Decode(&w), ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: in loop.yaml: line 1: in loop2.yaml: line 1: include cycle: loop.yaml -> loop2.yaml -> loop.yaml")
+
+	dec = yaml.NewDecoder(strings.NewReader("x: !include deep.yaml\n"))
+	dec.SetIncludeResolver(resolver)
+	dec.SetMaxDepth(2)
+	c.Assert(dec.Decode(&w), ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: in deep.yaml: exceeded max depth of 2")
+
+	dec = yaml.NewDecoder(strings.NewReader("x: !include db.yaml\n"))
+	dec.SetIncludeResolver(resolver)
+	dec.SetMaxNodes(6)
+	c.Assert(dec.Decode(&w), ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: in db.yaml: line 1: exceeded max of 6 nodes")
+
+	var plain map[string]string
+	c.Assert(yaml.Unmarshal([]byte("a: !include db.yaml\n"), &plain), IsNil)
+	c.Assert(plain, DeepEquals, map[string]string{"a": "db.yaml"})
+}
+
+func (s *S) TestDecoderExpandEnv(c *C) {
+	env := map[string]string{"HOST": "db", "PORT": "5432", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	var v struct {
+		URL     string
+		Port    int
+		User    string
+		Mode    string
+		Literal string
+	}
+	dec := yaml.NewDecoder(strings.NewReader("url: postgres://${HOST}:${PORT}\nport: ${PORT}\nuser: ${USER:-admin}\nmode: ${EMPTY:-ro}\nliteral: $${HOST}\n"))
+	dec.SetExpandEnv(lookup)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.URL, Equals, "postgres://db:5432")
+	c.Assert(v.Port, Equals, 5432)
+	c.Assert(v.User, Equals, "admin")
+	c.Assert(v.Mode, Equals, "ro")
+	c.Assert(v.Literal, Equals, "${HOST}")
+
+	dec = yaml.NewDecoder(strings.NewReader("url: x\nuser: ${USER}\n"))
+	dec.SetExpandEnv(lookup)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: unmarshal errors:\n  line 2: environment variable USER is not set")
+}
+
+func (s *S) TestUnmarshalNonStringKeys(c *C) {
+	type point struct{ X, Y int }
+	var points map[point]string
+	err := yaml.Unmarshal([]byte("? {x: 1, y: 2}\n: a\n{x: 3}: b\n"), &points)
+	c.Assert(err, IsNil)
+	c.Assert(points, DeepEquals, map[point]string{{1, 2}: "a", {3, 0}: "b"})
+
+	var ints map[int]bool
+	err = yaml.Unmarshal([]byte("1: yes\nx: no\n0x10: off\n"), &ints)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: invalid map key `x` for int")
+	c.Assert(ints, DeepEquals, map[int]bool{1: true, 16: false})
+
+	var bools map[bool]int
+	c.Assert(yaml.Unmarshal([]byte("true: 1\nno: 2\n"), &bools), IsNil)
+	c.Assert(bools, DeepEquals, map[bool]int{true: 1, false: 2})
+
+	points = nil
+	err = yaml.Unmarshal([]byte("? {x: a}\n: a\n"), &points)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `a` into int")
+}
+
+func (s *S) TestUnmarshalSetAndOmap(c *C) {
+	var v map[string]interface{}
+	err := yaml.Unmarshal([]byte("a: !!set {x, z}\nb: !!omap [z: 1, a: 2]\nc: !!pairs [a: 1, a: 2]\n"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v["a"], DeepEquals, yaml.Set{"x": {}, "z": {}})
+	c.Assert(v["b"], DeepEquals, yaml.Omap{{"z", 1}, {"a", 2}})
+	c.Assert(v["c"], DeepEquals, yaml.Pairs{{"a", 1}, {"a", 2}})
+
+	var set map[string]bool
+	err = yaml.Unmarshal([]byte("!!set\n? a\n? b\n"), &set)
+	c.Assert(err, IsNil)
+	c.Assert(set, DeepEquals, map[string]bool{"a": true, "b": true})
+
+	var members map[string]struct{}
+	err = yaml.Unmarshal([]byte("!!set {a}"), &members)
+	c.Assert(err, IsNil)
+	c.Assert(members, DeepEquals, map[string]struct{}{"a": {}})
+
+	err = yaml.Unmarshal([]byte("!!set {a: 1}"), &members)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: !!set member a must not have a value")
+
+	var m map[string]int
+	err = yaml.Unmarshal([]byte("!!omap\n- a: 1\n- b: 2\n"), &m)
+	c.Assert(err, IsNil)
+	c.Assert(m, DeepEquals, map[string]int{"a": 1, "b": 2})
+
+	var ms yaml.MapSlice
+	err = yaml.Unmarshal([]byte("!!omap\n- b: 1\n- a: 2\n"), &ms)
+	c.Assert(err, IsNil)
+	c.Assert(ms, DeepEquals, yaml.MapSlice{{"b", 1}, {"a", 2}})
+
+	err = yaml.Unmarshal([]byte("!!omap\n- a: 1\n  c: 3\n"), &ms)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: !!omap item must be a mapping with a single key")
+
+	// Other types of sequences are decoded as usual.
+	var items []map[string]int
+	err = yaml.Unmarshal([]byte("!!omap\n- a: 1\n- b: 2\n"), &items)
+	c.Assert(err, IsNil)
+	c.Assert(items, DeepEquals, []map[string]int{{"a": 1}, {"b": 2}})
+}
+
+func (s *S) TestDecoderNullPolicy(c *C) {
+	type T struct {
+		A int
+		B string
+		C *int
+		D interface{}
+	}
+	data := "a: ~\nb: null\nc:\nd: ~\n"
+	one := 1
+	v := T{A: 1, B: "b", C: &one, D: "d"}
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, T{})
+
+	v = T{A: 1, B: "b", C: &one, D: "d"}
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetNullPolicy(yaml.NullError)
+	err := dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: null is not allowed for int\n"+
+		"  line 2: null is not allowed for string")
+	c.Assert(v, DeepEquals, T{A: 1, B: "b"})
+
+	v = T{A: 1, B: "b", C: &one, D: "d"}
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetNullValues(-1)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, T{A: -1})
+
+	var ints []int
+	dec = yaml.NewDecoderWithOptions(strings.NewReader("[1, ~, 3]"), yaml.WithNullValues(-1, "none"))
+	c.Assert(dec.Decode(&ints), IsNil)
+	c.Assert(ints, DeepEquals, []int{1, -1, 3})
+
+	c.Assert(func() { dec.SetNullValues(nil) }, PanicMatches, "yaml: SetNullValues needs typed values, not nil")
+}
+
+func (s *S) TestDecoderResetTargets(c *C) {
+	type T struct {
+		A int
+		B map[string]int
+		C []int
+	}
+	v := T{A: 1, B: map[string]int{"x": 1}, C: []int{1, 2}}
+	dec := yaml.NewDecoder(strings.NewReader("b: {y: 2}\n"))
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, T{A: 1, B: map[string]int{"x": 1, "y": 2}, C: []int{1, 2}})
+
+	dec = yaml.NewDecoder(strings.NewReader("b: {y: 2}\n"))
+	dec.ResetTargets(true)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, T{B: map[string]int{"y": 2}})
+}
+
+func (s *S) TestDecoderInputEncoding(c *C) {
+	inputs := []string{
+		"a: b",
+		"\xef\xbb\xbfa: b",
+		"\xff\xfea\x00:\x00 \x00b\x00",
+		"\x00a\x00:\x00 \x00b",
+		"\xff\xfe\x00\x00a\x00\x00\x00:\x00\x00\x00 \x00\x00\x00b\x00\x00\x00",
+		"\x00\x00\x00a\x00\x00\x00:\x00\x00\x00 \x00\x00\x00b",
+	}
+	for _, input := range inputs {
+		var v map[string]string
+		dec := yaml.NewDecoder(strings.NewReader(input))
+		c.Assert(dec.Decode(&v), IsNil, Commentf("input %q", input))
+		c.Assert(v, DeepEquals, map[string]string{"a": "b"})
+	}
+
+	var v interface{}
+	err := yaml.Unmarshal([]byte("a: b\nc: \xff\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: line 2: invalid leading UTF-8 octet")
+
+	dec := yaml.NewDecoder(strings.NewReader("a: b"))
+	dec.SetBOMPolicy(yaml.BOMRequire)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: line 1: byte order mark is required")
+
+	dec = yaml.NewDecoder(strings.NewReader("\xef\xbb\xbfa: b"))
+	dec.SetBOMPolicy(yaml.BOMForbid)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: line 1: byte order mark is not allowed")
+}
+
+func (s *S) TestDecoderFilename(c *C) {
+	var v struct{ A int }
+	dec := yaml.NewDecoder(strings.NewReader("a: x\n"))
+	dec.SetFilename("app.yaml")
+	err := dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  app.yaml:1: cannot unmarshal !!str `x` into int")
+}
+
+func (s *S) TestDecoderDecodePath(c *C) {
+	data := `
+base: &base
+  image: app:1
+spec:
+  replicas: 3
+  containers:
+  - name: app
+    <<: *base
+`
+	var n int
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	c.Assert(dec.DecodePath("spec.replicas", &n), IsNil)
+	c.Assert(n, Equals, 3)
+
+	var image string
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	c.Assert(dec.DecodePath("spec.containers.0.image", &image), IsNil)
+	c.Assert(image, Equals, "app:1")
+
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	err := dec.DecodePath("spec.containers.1.name", &image)
+	c.Assert(err, ErrorMatches, "yaml: line 7: path spec.containers.1.name: spec.containers.1 not found")
+
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	err = dec.DecodePath("spec.replicas.max", &n)
+	c.Assert(err, ErrorMatches, `yaml: line 5: path spec.replicas.max: cannot look up "max" in a scalar`)
+
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	err = dec.DecodePath("spec.replicas", &image)
+	c.Assert(err, IsNil)
+	c.Assert(image, Equals, "3")
+	c.Assert(dec.DecodePath("spec", &image), Equals, io.EOF)
+}
+
+func (s *S) TestDecoderUnknownFieldWarnings(c *C) {
+	var v struct{ A int }
+	dec := yaml.NewDecoder(strings.NewReader("a: 1\nb: 2\nc: 3\n"))
+	dec.SetUnknownFieldWarnings(true)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.A, Equals, 1)
+	c.Assert(dec.Warnings(), DeepEquals, []string{
+		"line 2: field b not found in type struct { A int }",
+		"line 3: field c not found in type struct { A int }",
+	})
+
+	dec = yaml.NewDecoder(strings.NewReader("a: 1\nb: 2\n"))
+	dec.SetUnknownFieldWarnings(true)
+	dec.SetStrict(true)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: unmarshal errors:\n  line 2: field b not found in type struct { A int }")
+	c.Assert(dec.Warnings(), HasLen, 0)
+}
+
+func (s *S) TestDecoderAnchors(c *C) {
+	data := "a: &x 1\nb:\n  c: &y\n    d: *x\n---\ne: 2\n"
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	var v interface{}
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(dec.Anchors(), DeepEquals, map[string]yaml.Position{
+		"x": {Line: 1, Column: 4},
+		"y": {Line: 3, Column: 6},
+	})
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(dec.Anchors(), HasLen, 0)
+}
+
+func (s *S) TestDecoderDisallowAnchors(c *C) {
+	var v interface{}
+	dec := yaml.NewDecoder(strings.NewReader("a: 1\nb: &x 2\nc: *x\n"))
+	dec.DisallowAnchors()
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: line 2: anchor 'x' is not allowed")
+
+	dec = yaml.NewDecoderWithOptions(strings.NewReader("a: 1\nc: *x\n"), yaml.WithoutAnchors())
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: line 2: alias 'x' is not allowed")
+
+	dec = yaml.NewDecoderWithOptions(strings.NewReader("a: 1\n"), yaml.WithoutAnchors())
+	c.Assert(dec.Decode(&v), IsNil)
+}
+
+type workload interface {
+	Replicas() int
+}
+
+type deployment struct {
+	Name  string
+	Count int
+}
+
+func (d deployment) Replicas() int { return d.Count }
+
+type cronJob struct {
+	Name     string
+	Schedule string
+}
+
+func (j *cronJob) Replicas() int { return 1 }
+
+func (s *S) TestDecoderRegisterType(c *C) {
+	data := `
+- !Deployment {name: web, count: 3}
+- !CronJob {name: backup, schedule: "@daily"}
+`
+	var v []workload
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.RegisterType("!Deployment", deployment{})
+	dec.RegisterType("!CronJob", cronJob{})
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, []workload{
+		deployment{Name: "web", Count: 3},
+		&cronJob{Name: "backup", Schedule: "@daily"},
+	})
+
+	var m map[string]interface{}
+	dec = yaml.NewDecoder(strings.NewReader("a: !Deployment {name: web}\nb: !Job {name: x}\nc: !!str 1\n"))
+	dec.RegisterType("!Deployment", deployment{})
+	dec.RegisterType("!CronJob", cronJob{})
+	err := dec.Decode(&m)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: unknown tag !Job; registered tags are !CronJob, !Deployment")
+	c.Assert(m, DeepEquals, map[string]interface{}{"a": deployment{Name: "web"}, "c": "1"})
+
+	dec = yaml.NewDecoder(strings.NewReader("- !Name foo\n"))
+	dec.RegisterType("!Name", "")
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: unmarshal errors:\n  line 1: type string registered for !Name does not implement yaml_test.workload")
+
+	var l []interface{}
+	dec = yaml.NewDecoder(strings.NewReader("- ! 12\n- !env HOME\n"))
+	dec.RegisterType("!Deployment", deployment{})
+	dec.RegisterTag("!env", func(unmarshal func(interface{}) error) (interface{}, error) {
+		var v interface{}
+		err := unmarshal(&v)
+		return v, err
+	})
+	c.Assert(dec.Decode(&l), IsNil)
+	c.Assert(l, DeepEquals, []interface{}{"12", "HOME"})
+}
+
+func (s *S) TestDecoderRegisterUnion(c *C) {
+	type shapes struct {
+		Shapes []workload
+	}
+	data := `
+shapes:
+- {kind: Deployment, name: web, count: 3}
+- {kind: CronJob, name: backup}
+- {name: none}
+- {kind: Job}
+`
+	var v shapes
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.RegisterUnion((*workload)(nil), "kind", map[string]interface{}{
+		"Deployment": deployment{},
+		"CronJob":    cronJob{},
+	})
+	err := dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 5: missing kind for yaml_test.workload; valid kinds are CronJob, Deployment\n"+
+		"  line 6: unknown kind Job for yaml_test.workload; valid kinds are CronJob, Deployment")
+	c.Assert(v.Shapes, DeepEquals, []workload{
+		deployment{Name: "web", Count: 3},
+		&cronJob{Name: "backup"},
+	})
+}
+
+func (s *S) TestDecoderMaxDocuments(c *C) {
+	dec := yaml.NewDecoder(strings.NewReader("a: 1\n---\na: 2\n---\na: 3\n"))
+	dec.SetMaxDocuments(2)
+	var v map[string]int
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: line 4: exceeded max of 2 documents")
+
+	var all []map[string]int
+	dec = yaml.NewDecoderWithOptions(strings.NewReader("a: 1\n---\na: 2\n"), yaml.WithMaxDocuments(2))
+	c.Assert(dec.DecodeAll(&all), IsNil)
+	c.Assert(all, HasLen, 2)
+}
+
+func (s *S) TestDecoderJSONTags(c *C) {
+	type T struct {
+		Name    string `json:"name_field"`
+		Count   int    `json:"count,omitempty,string"`
+		Skipped int    `json:"-"`
+		Both    int    `json:"json_key" yaml:"yaml_key"`
+	}
+	data := "name_field: a\ncount: 2\nskipped: 3\nyaml_key: 4\njson_key: 5\n"
+	var v T
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetJSONTags(true)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, T{Name: "a", Count: 2, Both: 4})
+
+	v = T{}
+	c.Assert(yaml.Unmarshal([]byte(data), &v), IsNil)
+	c.Assert(v, DeepEquals, T{Count: 2, Skipped: 3, Both: 4})
+
+	type Conflict struct {
+		A int `json:"b"`
+		B int
+	}
+	dec = yaml.NewDecoder(strings.NewReader("b: 1\n"))
+	dec.SetJSONTags(true)
+	c.Assert(dec.Decode(&Conflict{}), ErrorMatches, "Duplicated key 'b' in struct yaml_test.Conflict")
+}
+
+func (s *S) TestDecoderInlineEmbedded(c *C) {
+	type Base struct{ ID int }
+	type Meta struct{ Owner string }
+	type T struct {
+		Base
+		Meta `yaml:"meta"`
+		Name string
+	}
+	var v T
+	dec := yaml.NewDecoderWithOptions(strings.NewReader("id: 1\nmeta: {owner: me}\nname: a\n"), yaml.WithInlineEmbedded(true))
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, T{Base{1}, Meta{"me"}, "a"})
+
+	v = T{}
+	c.Assert(yaml.Unmarshal([]byte("id: 1\nbase: {id: 2}\n"), &v), IsNil)
+	c.Assert(v, DeepEquals, T{Base: Base{2}})
+
+	type Named struct{ Name, Kind string }
+	type Deep struct{ Named }
+	type Other struct{ Kind string }
+	type U struct {
+		Deep
+		Other
+		Name string
+	}
+	var u U
+	dec = yaml.NewDecoderWithOptions(strings.NewReader("name: a\nkind: b\n"), yaml.WithInlineEmbedded(true))
+	c.Assert(dec.Decode(&u), IsNil)
+	c.Assert(u, DeepEquals, U{Other: Other{"b"}, Name: "a"})
+
+	type V struct {
+		Base
+		Other Base
+	}
+	type W struct {
+		Base
+		V
+	}
+	var w W
+	dec = yaml.NewDecoderWithOptions(strings.NewReader("id: 1\nother: {id: 2}\n"), yaml.WithInlineEmbedded(true))
+	c.Assert(dec.Decode(&w), IsNil)
+	c.Assert(w, DeepEquals, W{Base{1}, V{Other: Base{2}}})
+}
+
+func (s *S) TestDecoderDecodeValue(c *C) {
+	var v struct {
+		A map[string]int
+	}
+	dec := yaml.NewDecoder(strings.NewReader("b: 1\n---\nb: x\n---\nc: 3\n"))
+	c.Assert(dec.DecodeValue(reflect.ValueOf(&v).Elem().Field(0)), IsNil)
+	c.Assert(v.A, DeepEquals, map[string]int{"b": 1})
+
+	err := dec.DecodeValue(reflect.ValueOf(&v.A))
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 3: cannot unmarshal !!str `x` into int")
+
+	err = dec.DecodeValue(reflect.ValueOf(v))
+	c.Assert(err, ErrorMatches, "yaml: DecodeValue needs a settable value or a non-nil pointer")
+	c.Assert(dec.DecodeValue(reflect.ValueOf(&v.A)), IsNil)
+	c.Assert(v.A, DeepEquals, map[string]int{"b": 1, "c": 3})
+}
+
+func (s *S) TestUnmarshalInlineStructWithInlineMap(c *C) {
+	type Meta struct {
+		Name  string
+		Extra map[string]int `yaml:",inline"`
+	}
+	type T struct {
+		Meta  `yaml:",inline"`
+		Count int
+	}
+	var v T
+	err := yaml.Unmarshal([]byte("name: a\ncount: 1\nx: 2\nz: 3\n"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, T{Meta: Meta{Name: "a", Extra: map[string]int{"x": 2, "z": 3}}, Count: 1})
+
+	data, err := yaml.Marshal(v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "name: a\ncount: 1\nx: 2\nz: 3\n")
+
+	v.Extra["count"] = 4
+	_, err = yaml.Marshal(v)
+	c.Assert(err, ErrorMatches, `Can't have key "count" in inlined map; conflicts with struct field`)
+	c.Assert(err, DeepEquals, &yaml.StructError{
+		Type: reflect.TypeOf(v),
+		Key:  "count",
+		Msg:  `Can't have key "count" in inlined map; conflicts with struct field`,
+	})
+
+	type Both struct {
+		Meta  `yaml:",inline"`
+		Other map[string]int `yaml:",inline"`
+	}
+	err = yaml.Unmarshal([]byte("name: a\n"), &Both{})
+	c.Assert(err, ErrorMatches, "Multiple ,inline maps in struct yaml_test.Both")
+	serr, ok := err.(*yaml.StructError)
+	c.Assert(ok, Equals, true)
+	c.Assert(serr.Type, Equals, reflect.TypeOf(Both{}))
+	c.Assert(serr.Key, Equals, "")
+
+	type Dup struct {
+		Meta `yaml:",inline"`
+		N    int `yaml:"name"`
+	}
+	err = yaml.Unmarshal([]byte("name: a\n"), &Dup{})
+	c.Assert(err, DeepEquals, &yaml.StructError{
+		Type: reflect.TypeOf(Dup{}),
+		Key:  "name",
+		Msg:  "Duplicated key 'name' in struct yaml_test.Dup",
+	})
+}
+
+func (s *S) TestDecoderInputOffset(c *C) {
+	data := "a: 1\n---\nb: é\n...\n---\nc: [1, 2]\r\n"
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	c.Assert(dec.InputOffset(), Equals, int64(0))
+	var offsets []int64
+	var positions []yaml.Position
+	for {
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			c.Assert(err, Equals, io.EOF)
+			break
+		}
+		offsets = append(offsets, dec.InputOffset())
+		positions = append(positions, dec.Position())
+	}
+	c.Assert(offsets, DeepEquals, []int64{5, 18, int64(len(data))})
+	c.Assert(data[5:18], Equals, "---\nb: é\n...")
+	c.Assert(positions, DeepEquals, []yaml.Position{{2, 1}, {4, 4}, {7, 1}})
+}
+
+func (s *S) TestDecoderMaxNodes(c *C) {
+	var v interface{}
+	dec := yaml.NewDecoder(strings.NewReader("a: [1, 2]\nb: 3\n"))
+	dec.SetMaxNodes(8)
+	c.Assert(dec.Decode(&v), IsNil)
+
+	dec = yaml.NewDecoder(strings.NewReader("a: &x [1, 2]\nb: *x\n"))
+	dec.SetMaxNodes(8)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: line 1: exceeded max of 8 nodes")
+}
+
+func (s *S) TestDecoderExactNumbers(c *C) {
+	type T struct {
+		I   int
+		U   uint8
+		F32 float32
+		F64 float64
+	}
+	var v T
+	dec := yaml.NewDecoder(strings.NewReader("i: 3.0\nu: 7\nf32: 1.5\nf64: 9007199254740992\n"))
+	dec.SetExactNumbers(true)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, T{3, 7, 1.5, 9007199254740992})
+
+	data := "i: 3.7\nu: -1.0\nf32: 1e300\nf64: 9007199254740993\n"
+	v = T{}
+	c.Assert(yaml.Unmarshal([]byte("i: 3.7\n"), &v), IsNil)
+	c.Assert(v.I, Equals, 3)
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetExactNumbers(true)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: cannot unmarshal !!float `3.7` into int without loss\n"+
+		"  line 2: cannot unmarshal !!float `-1.0` into uint8 without loss\n"+
+		"  line 3: cannot unmarshal !!float `1e300` into float32 without loss\n"+
+		"  line 4: cannot unmarshal !!int `9007199...` into float64 without loss")
+
+	var w struct {
+		A int `yaml:"a,exact"`
+		B int
+	}
+	err := yaml.Unmarshal([]byte("a: 1.5\nb: 2.5\n"), &w)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!float `1.5` into int without loss")
+	c.Assert(w.B, Equals, 2)
+}
+
+func (s *S) TestDecoderTabWidth(c *C) {
+	var v map[string]interface{}
+	err := yaml.NewDecoder(strings.NewReader("a:\n  b: 1\n\tc: 2\n")).Decode(&v)
+	c.Assert(err, ErrorMatches, `yaml: line 3: found a tab character that violates indentation \(replace the tab at column 1 with spaces\)`)
+
+	err = yaml.Unmarshal([]byte("\ta: 1\n"), &v)
+	c.Assert(err, ErrorMatches, `yaml: line 1: .* \(replace the tab at column 1 with spaces\)`)
+
+	for _, r := range []io.Reader{strings.NewReader("a:\n\tb: 1\n  \tc: |\n\t\tx\n"), iotest.OneByteReader(strings.NewReader("a:\n\tb: 1\n  \tc: |\n\t\tx\n"))} {
+		v = nil
+		dec := yaml.NewDecoderWithOptions(r, yaml.WithTabWidth(4))
+		c.Assert(dec.Decode(&v), IsNil)
+		c.Assert(v, DeepEquals, map[string]interface{}{"a": map[interface{}]interface{}{"b": 1, "c": "x\n"}})
+	}
+
+	v = nil
+	dec := yaml.NewDecoderWithOptions(strings.NewReader("a: |\n  x\n  \ty\nb: |\n\tx\n\t\ty\n"), yaml.WithTabWidth(4))
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{"a": "x\n\ty\n", "b": "x\n\ty\n"})
+}
+
+func (s *S) TestDecoderBytesFormat(c *C) {
+	var v struct {
+		A []byte `yaml:",bytes=string"`
+		B []byte `yaml:",bytes=base64"`
+		C []byte
+		D []byte
+	}
+	data := "a: text\nb: aGk=\nc: !!binary aGk=\nd: [104, 105]\n"
+	c.Assert(yaml.Unmarshal([]byte(data), &v), IsNil)
+	c.Assert(string(v.A), Equals, "text")
+	c.Assert(string(v.B), Equals, "hi")
+	c.Assert(string(v.C), Equals, "hi")
+	c.Assert(string(v.D), Equals, "hi")
+
+	err := yaml.Unmarshal([]byte("c: 6869\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!int `6869` into \\[\\]uint8")
+	err = yaml.Unmarshal([]byte("c: text\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `text` into \\[\\]uint8")
+
+	dec := yaml.NewDecoderWithOptions(strings.NewReader("c: zz\n"), yaml.WithBytesFormat(yaml.BytesHex))
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: unmarshal errors:\n  line 1: invalid hex data `zz` for \\[\\]uint8")
+}
+
 type textUnmarshaler struct {
 	S string
 }
@@ -203,7 +203,13 @@ func yaml_emitter_increase_indent(emitter *yaml_emitter_t, flow, indentless bool
 			emitter.indent = 0
 		}
 	} else if !indentless {
-		emitter.indent += emitter.best_indent
+		if len(emitter.states) > 0 && emitter.states[len(emitter.states)-1] == yaml_EMIT_BLOCK_SEQUENCE_ITEM_STATE {
+			// The first indent inside a sequence item just skips the "- " indicator.
+			emitter.indent += 2
+		} else {
+			// Everything else aligns to the chosen indentation.
+			emitter.indent = emitter.best_indent * ((emitter.indent + emitter.best_indent) / emitter.best_indent)
+		}
 	}
 	return true
 }
@@ -313,6 +319,14 @@ func yaml_emitter_emit_document_start(emitter *yaml_emitter_t, event *yaml_event
 
 	if event.typ == yaml_DOCUMENT_START_EVENT {
 
+		if len(emitter.pending_break) > 0 {
+			if !flush(emitter) {
+				return false
+			}
+			emitter.buffer_pos += copy(emitter.buffer[emitter.buffer_pos:], emitter.pending_break)
+			emitter.pending_break = emitter.pending_break[:0]
+		}
+
 		if event.version_directive != nil {
 			if !yaml_emitter_analyze_version_directive(emitter, event.version_directive) {
 				return false
@@ -337,7 +351,7 @@ func yaml_emitter_emit_document_start(emitter *yaml_emitter_t, event *yaml_event
 		}
 
 		implicit := event.implicit
-		if !first || emitter.canonical {
+		if (!first && !emitter.implicit_documents) || emitter.canonical {
 			implicit = false
 		}
 
@@ -355,7 +369,8 @@ func yaml_emitter_emit_document_start(emitter *yaml_emitter_t, event *yaml_event
 			if !yaml_emitter_write_indicator(emitter, []byte("%YAML"), true, false, false) {
 				return false
 			}
-			if !yaml_emitter_write_indicator(emitter, []byte("1.1"), true, false, false) {
+			version := fmt.Sprintf("%d.%d", event.version_directive.major, event.version_directive.minor)
+			if !yaml_emitter_write_indicator(emitter, []byte(version), true, false, false) {
 				return false
 			}
 			if !yaml_emitter_write_indent(emitter) {
@@ -433,18 +448,30 @@ func yaml_emitter_emit_document_end(emitter *yaml_emitter_t, event *yaml_event_t
 	if event.typ != yaml_DOCUMENT_END_EVENT {
 		return yaml_emitter_set_emitter_error(emitter, "expected DOCUMENT-END")
 	}
-	if !yaml_emitter_write_indent(emitter) {
-		return false
-	}
 	if !event.implicit {
-		// [Go] Allocate the slice elsewhere.
-		if !yaml_emitter_write_indicator(emitter, []byte("..."), true, false, false) {
+		if !yaml_emitter_write_indent(emitter) {
 			return false
 		}
-		if !yaml_emitter_write_indent(emitter) {
+		// [Go] Allocate the slice elsewhere.
+		if !yaml_emitter_write_indicator(emitter, []byte("..."), true, false, false) {
 			return false
 		}
 	}
+	if !flush(emitter) {
+		return false
+	}
+	pos := emitter.buffer_pos
+	if !yaml_emitter_write_indent(emitter) {
+		return false
+	}
+	if emitter.no_final_break {
+		emitter.pending_break = append(emitter.pending_break[:0], emitter.buffer[pos:emitter.buffer_pos]...)
+		emitter.buffer_pos = pos
+	}
+	if event.implicit {
+		// The next document needs a "..." marker before its directives.
+		emitter.open_ended = true
+	}
 	if !yaml_emitter_flush(emitter) {
 		return false
 	}
@@ -492,7 +519,7 @@ func yaml_emitter_emit_flow_sequence_item(emitter *yaml_emitter_t, event *yaml_e
 		}
 	}
 
-	if emitter.canonical || emitter.column > emitter.best_width {
+	if emitter.canonical || emitter.column > emitter.best_width && !emitter.no_flow_wraps {
 		if !yaml_emitter_write_indent(emitter) {
 			return false
 		}
@@ -538,7 +565,7 @@ func yaml_emitter_emit_flow_mapping_key(emitter *yaml_emitter_t, event *yaml_eve
 			return false
 		}
 	}
-	if emitter.canonical || emitter.column > emitter.best_width {
+	if emitter.canonical || emitter.column > emitter.best_width && !emitter.no_flow_wraps {
 		if !yaml_emitter_write_indent(emitter) {
 			return false
 		}
@@ -562,7 +589,7 @@ func yaml_emitter_emit_flow_mapping_value(emitter *yaml_emitter_t, event *yaml_e
 			return false
 		}
 	} else {
-		if emitter.canonical || emitter.column > emitter.best_width {
+		if emitter.canonical || emitter.column > emitter.best_width && !emitter.no_flow_wraps {
 			if !yaml_emitter_write_indent(emitter) {
 				return false
 			}
@@ -578,7 +605,8 @@ func yaml_emitter_emit_flow_mapping_value(emitter *yaml_emitter_t, event *yaml_e
 // Expect a block item node.
 func yaml_emitter_emit_block_sequence_item(emitter *yaml_emitter_t, event *yaml_event_t, first bool) bool {
 	if first {
-		if !yaml_emitter_increase_indent(emitter, false, emitter.mapping_context && !emitter.indention) {
+		indentless := emitter.mapping_context && !emitter.indention && !emitter.indent_sequences
+		if !yaml_emitter_increase_indent(emitter, false, indentless) {
 			return false
 		}
 	}
@@ -592,6 +620,14 @@ func yaml_emitter_emit_block_sequence_item(emitter *yaml_emitter_t, event *yaml_
 	if !yaml_emitter_write_indent(emitter) {
 		return false
 	}
+	if key := yaml_emitter_item_key(emitter); key != nil && len(key.head_comment) > 0 {
+		// Write the comment of the first key of the item before the
+		// dash, rather than between the dash and the key.
+		if !yaml_emitter_write_comment(emitter, key.head_comment) {
+			return false
+		}
+		key.head_comment = nil
+	}
 	if !yaml_emitter_write_indicator(emitter, []byte{'-'}, true, false, true) {
 		return false
 	}
@@ -599,6 +635,25 @@ func yaml_emitter_emit_block_sequence_item(emitter *yaml_emitter_t, event *yaml_
 	return yaml_emitter_emit_node(emitter, event, false, true, false, false)
 }
 
+// Find the first key of the block mapping that starts the current
+// sequence item, directly or within nested block sequences, if the
+// events up to it are queued.
+func yaml_emitter_item_key(emitter *yaml_emitter_t) *yaml_event_t {
+	i := emitter.events_head
+	for i < len(emitter.events) && emitter.events[i].typ == yaml_SEQUENCE_START_EVENT &&
+		emitter.events[i].sequence_style() != yaml_FLOW_SEQUENCE_STYLE {
+		i++
+	}
+	if i+1 >= len(emitter.events) || emitter.events[i].typ != yaml_MAPPING_START_EVENT ||
+		emitter.events[i].mapping_style() == yaml_FLOW_MAPPING_STYLE {
+		return nil
+	}
+	if emitter.events[i+1].typ != yaml_SCALAR_EVENT {
+		return nil
+	}
+	return &emitter.events[i+1]
+}
+
 // Expect a block key node.
 func yaml_emitter_emit_block_mapping_key(emitter *yaml_emitter_t, event *yaml_event_t, first bool) bool {
 	if first {
@@ -616,6 +671,11 @@ func yaml_emitter_emit_block_mapping_key(emitter *yaml_emitter_t, event *yaml_ev
 	if !yaml_emitter_write_indent(emitter) {
 		return false
 	}
+	if len(event.head_comment) > 0 {
+		if !yaml_emitter_write_comment(emitter, event.head_comment) {
+			return false
+		}
+	}
 	if yaml_emitter_check_simple_key(emitter) {
 		emitter.states = append(emitter.states, yaml_EMIT_BLOCK_MAPPING_SIMPLE_VALUE_STATE)
 		return yaml_emitter_emit_node(emitter, event, false, false, true, true)
@@ -813,6 +873,14 @@ func yaml_emitter_select_scalar_style(emitter *yaml_emitter_t, event *yaml_event
 		style = yaml_DOUBLE_QUOTED_SCALAR_STYLE
 	}
 
+	if style == yaml_PLAIN_SCALAR_STYLE && event.implicit && len(emitter.scalar_data.value) == 0 &&
+		(emitter.flow_level > 0 || emitter.simple_key_context) {
+		// [Go] An empty plain scalar is null, which is written
+		// out where it can't be empty.
+		if !yaml_emitter_analyze_scalar(emitter, []byte("null")) {
+			return false
+		}
+	}
 	if style == yaml_PLAIN_SCALAR_STYLE {
 		if emitter.flow_level > 0 && !emitter.scalar_data.flow_plain_allowed ||
 			emitter.flow_level == 0 && !emitter.scalar_data.block_plain_allowed {
@@ -889,15 +957,16 @@ func yaml_emitter_process_tag(emitter *yaml_emitter_t) bool {
 
 // Write a scalar.
 func yaml_emitter_process_scalar(emitter *yaml_emitter_t) bool {
+	allow_breaks := !emitter.simple_key_context && (emitter.flow_level == 0 || !emitter.no_flow_folds)
 	switch emitter.scalar_data.style {
 	case yaml_PLAIN_SCALAR_STYLE:
-		return yaml_emitter_write_plain_scalar(emitter, emitter.scalar_data.value, !emitter.simple_key_context)
+		return yaml_emitter_write_plain_scalar(emitter, emitter.scalar_data.value, allow_breaks)
 
 	case yaml_SINGLE_QUOTED_SCALAR_STYLE:
-		return yaml_emitter_write_single_quoted_scalar(emitter, emitter.scalar_data.value, !emitter.simple_key_context)
+		return yaml_emitter_write_single_quoted_scalar(emitter, emitter.scalar_data.value, allow_breaks)
 
 	case yaml_DOUBLE_QUOTED_SCALAR_STYLE:
-		return yaml_emitter_write_double_quoted_scalar(emitter, emitter.scalar_data.value, !emitter.simple_key_context)
+		return yaml_emitter_write_double_quoted_scalar(emitter, emitter.scalar_data.value, allow_breaks)
 
 	case yaml_LITERAL_SCALAR_STYLE:
 		return yaml_emitter_write_literal_scalar(emitter, emitter.scalar_data.value)
@@ -910,7 +979,7 @@ func yaml_emitter_process_scalar(emitter *yaml_emitter_t) bool {
 
 // Check if a %YAML directive is valid.
 func yaml_emitter_analyze_version_directive(emitter *yaml_emitter_t, version_directive *yaml_version_directive_t) bool {
-	if version_directive.major != 1 || version_directive.minor != 1 {
+	if version_directive.major != 1 || version_directive.minor != 1 && version_directive.minor != 2 {
 		return yaml_emitter_set_emitter_error(emitter, "incompatible %YAML directive")
 	}
 	return true
@@ -1218,6 +1287,37 @@ func yaml_emitter_write_indent(emitter *yaml_emitter_t) bool {
 	return true
 }
 
+// Write a comment, each of its lines on a line of its own at the
+// current indentation.
+func yaml_emitter_write_comment(emitter *yaml_emitter_t, comment []byte) bool {
+	// Leading line breaks are written as blank lines.
+	for len(comment) > 0 && comment[0] == '\n' {
+		if !put_break(emitter) || !yaml_emitter_write_indent(emitter) {
+			return false
+		}
+		comment = comment[1:]
+	}
+	if len(comment) == 0 {
+		return true
+	}
+	for _, line := range bytes.Split(comment, []byte{'\n'}) {
+		if !put(emitter, '#') {
+			return false
+		}
+		if len(line) > 0 && !put(emitter, ' ') {
+			return false
+		}
+		if !write_all(emitter, line) {
+			return false
+		}
+		emitter.indention = false
+		if !yaml_emitter_write_indent(emitter) {
+			return false
+		}
+	}
+	return true
+}
+
 func yaml_emitter_write_indicator(emitter *yaml_emitter_t, indicator []byte, need_whitespace, is_whitespace, is_indention bool) bool {
 	if need_whitespace && !emitter.whitespace {
 		if !put(emitter, ' ') {
@@ -1311,7 +1411,7 @@ func yaml_emitter_write_tag_content(emitter *yaml_emitter_t, value []byte, need_
 }
 
 func yaml_emitter_write_plain_scalar(emitter *yaml_emitter_t, value []byte, allow_breaks bool) bool {
-	if !emitter.whitespace {
+	if len(value) > 0 && !emitter.whitespace {
 		if !put(emitter, ' ') {
 			return false
 		}
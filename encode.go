@@ -1,9 +1,14 @@
 package yaml
 
 import (
+	"bytes"
 	"encoding"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"math/big"
+	"net"
+	"net/url"
 	"reflect"
 	"regexp"
 	"sort"
@@ -34,6 +39,104 @@ type encoder struct {
 	// doneInit holds whether the initial stream_start_event has been
 	// emitted.
 	doneInit bool
+	schema   Schema
+	// timeFormat holds the layout of the struct field being encoded,
+	// from its format tag flag.
+	timeFormat string
+	// jsonTags holds whether json tags are used for struct fields
+	// without yaml tags.
+	jsonTags bool
+	// embedInline holds whether anonymous struct fields are inlined
+	// without an inline flag.
+	embedInline bool
+	// flowWidth, when greater than zero, is the width under which
+	// nested collections of scalars are written in flow style.
+	flowWidth int
+	// flowWrap selects how flow collections longer than the line
+	// width are written, and flowFits holds whether the flow
+	// collection being written was measured to fit on a line.
+	flowWrap FlowWrap
+	flowFits bool
+	// depth is the number of collections being written.
+	depth int
+	// keyLess, if set, orders map keys in place of keyList.
+	keyLess func(a, b reflect.Value) bool
+	// sortFields holds whether struct fields are written in the
+	// order of their keys.
+	sortFields bool
+	// anchorName, if set, names the anchors written for values
+	// referenced more than once in a document. refs counts those
+	// references, and anchors holds the names of the values already
+	// written. anchor is the name of the anchor for the next node.
+	anchorName func(n int, v interface{}) string
+	refs       map[refKey]int
+	anchors    map[refKey]string
+	anchor     string
+	// multiline is the style of strings holding newlines, if set.
+	// stringStyle is the style of all strings marshalled from the
+	// value of the struct field being encoded, if set by its flags.
+	multiline   yaml_scalar_style_t
+	stringStyle yaml_scalar_style_t
+	// canonical holds whether the output is in canonical form, with
+	// the tags of all nodes written out. explicitTags holds whether
+	// the tags are written out in any form but JSON.
+	canonical    bool
+	explicitTags bool
+	// json holds whether the output is restricted to JSON, and
+	// jsonKey whether the scalar being written is a mapping key.
+	json    bool
+	jsonKey bool
+	// null, if set, is the text of nil values, which include nil
+	// maps and slices.
+	null *string
+	// numericDurations holds whether time.Duration values are
+	// written as integers of nanoseconds.
+	numericDurations bool
+	// explicitEmpty holds whether empty non-nil slices and maps are
+	// written even for omitempty fields.
+	explicitEmpty bool
+	// floatFormat and floatPrec, if floatFormat is set, are the
+	// format and precision of floats as understood by
+	// strconv.FormatFloat. floatPoint holds whether whole floats
+	// are written with a decimal point.
+	floatFormat byte
+	floatPrec   int
+	floatPoint  bool
+	// bytes is the format of byte slices.
+	bytes BytesFormat
+	// inSeq holds whether a sequence begun by beginSeq is open.
+	inSeq bool
+	// markers selects the markers written around documents.
+	markers DocumentMarkers
+	// quoting selects which strings are quoted, and quoteStyle,
+	// if set, the quotes used.
+	quoting    Quoting
+	quoteStyle yaml_scalar_style_t
+	// comment holds the comment of the struct field whose key is
+	// the next scalar written.
+	comment string
+	// sectionComment, if set, returns the comment written before
+	// each key of the top-level mapping, and sections counts the keys
+	// of that mapping written so far.
+	sectionComment func(key interface{}) string
+	sections       int
+	// skeleton holds whether all struct fields are written, with
+	// their defaults in place of zero values, and nil pointers to
+	// structs as their zero values. expanding holds the types of
+	// the zero values being written.
+	skeleton  bool
+	expanding map[reflect.Type]bool
+	// tags holds the tags of the values of the registered types.
+	tags map[reflect.Type]string
+	// scalarKeys holds whether map keys must be written as scalars,
+	// and keyType is the type of the key being written until its
+	// scalar is.
+	scalarKeys bool
+	keyType    reflect.Type
+	// version and tagDirectives are the directives written before
+	// each document.
+	version       *yaml_version_directive_t
+	tagDirectives []yaml_tag_directive_t
 }
 
 func newEncoder() *encoder {
@@ -71,6 +174,38 @@ func (e *encoder) destroy() {
 	yaml_emitter_delete(&e.emitter)
 }
 
+// reset prepares e to write a new stream to w, keeping its settings
+// and reusing the buffers of its emitter.
+func (e *encoder) reset(w io.Writer) {
+	old := &e.emitter
+	e.emitter = yaml_emitter_t{
+		buffer:             old.buffer[:cap(old.buffer)],
+		raw_buffer:         old.raw_buffer[:0],
+		states:             old.states[:0],
+		events:             old.events[:0],
+		indents:            old.indents[:0],
+		canonical:          old.canonical,
+		best_indent:        old.best_indent,
+		best_width:         old.best_width,
+		unicode:            old.unicode,
+		line_break:         old.line_break,
+		indent_sequences:   old.indent_sequences,
+		implicit_documents: old.implicit_documents,
+		no_final_break:     old.no_final_break,
+		no_flow_wraps:      old.no_flow_wraps,
+		no_flow_folds:      old.no_flow_folds,
+	}
+	yaml_emitter_set_output_writer(&e.emitter, w)
+	e.event = yaml_event_t{}
+	e.out = nil
+	e.doneInit = false
+	e.inSeq = false
+	e.depth = 0
+	e.flow = false
+	e.anchor = ""
+	e.comment = ""
+}
+
 func (e *encoder) emit() {
 	// This will internally delete the e.event value.
 	e.must(yaml_emitter_emit(&e.emitter, &e.event))
@@ -87,21 +222,106 @@ func (e *encoder) must(ok bool) {
 }
 
 func (e *encoder) marshalDoc(tag string, in reflect.Value) {
+	if e.inSeq {
+		failf("cannot encode a document while a sequence is open")
+	}
+	e.startDoc()
+	if e.anchorName != nil && !e.json {
+		e.refs = make(map[refKey]int)
+		e.countRefs(in)
+	}
+	e.marshal(tag, in)
+	e.endDoc()
+}
+
+func (e *encoder) startDoc() {
 	e.init()
-	yaml_document_start_event_initialize(&e.event, nil, nil, true)
+	version, tagDirectives := e.version, e.tagDirectives
+	if e.json {
+		version, tagDirectives = nil, nil
+	}
+	yaml_document_start_event_initialize(&e.event, version, tagDirectives, e.markers != MarkStart && e.markers != MarkStartEnd)
 	e.emit()
-	e.marshal(tag, in)
-	yaml_document_end_event_initialize(&e.event, true)
+	if e.anchorName != nil && !e.json {
+		e.anchors = make(map[refKey]string)
+	}
+}
+
+func (e *encoder) endDoc() {
+	yaml_document_end_event_initialize(&e.event, e.markers != MarkStartEnd && e.markers != MarkEnd)
+	e.emit()
+}
+
+// beginSeq starts a document holding a sequence, whose items are then
+// written one at a time by item until endSeq.
+func (e *encoder) beginSeq() {
+	if e.inSeq {
+		failf("sequence already open")
+	}
+	e.startDoc()
+	tag, implicit := "", true
+	if e.allTags() {
+		tag, implicit = yaml_SEQ_TAG, false
+	}
+	style := yaml_BLOCK_SEQUENCE_STYLE
+	if e.json {
+		style = yaml_FLOW_SEQUENCE_STYLE
+	}
+	e.must(yaml_sequence_start_event_initialize(&e.event, nil, []byte(tag), implicit, style))
+	e.emit()
+	e.depth++
+	e.inSeq = true
+}
+
+// item writes in as the next item of the open sequence, and flushes
+// the output.
+func (e *encoder) item(in reflect.Value) {
+	if !e.inSeq {
+		failf("no sequence open")
+	}
+	if e.anchorName != nil && !e.json {
+		e.refs = make(map[refKey]int)
+		e.countRefs(in)
+	}
+	e.marshal("", in)
+	e.must(yaml_emitter_flush(&e.emitter))
+}
+
+// endSeq ends the open sequence and its document.
+func (e *encoder) endSeq() {
+	if !e.inSeq {
+		failf("no sequence open")
+	}
+	e.must(yaml_sequence_end_event_initialize(&e.event))
 	e.emit()
+	e.depth--
+	e.inSeq = false
+	e.endDoc()
 }
 
 func (e *encoder) marshal(tag string, in reflect.Value) {
+	if e.skeleton && in.Kind() == reflect.Ptr && in.IsNil() {
+		e.skeletonv(tag, in.Type().Elem())
+		return
+	}
 	if !in.IsValid() || in.Kind() == reflect.Ptr && in.IsNil() {
 		e.nilv()
 		return
 	}
+	if e.refs != nil && e.shared(in) {
+		return
+	}
+	if tag == "" && e.tags != nil {
+		tag = e.tags[in.Type()]
+	}
 	iface := in.Interface()
 	switch m := iface.(type) {
+	case Number:
+		if m.resolve() != nil {
+			e.emitScalar(string(m), "", tag, yaml_PLAIN_SCALAR_STYLE)
+			return
+		}
+		in = reflect.ValueOf(string(m))
 	case jsonNumber:
 		integer, err := m.Int64()
 		if err == nil {
@@ -117,6 +337,41 @@ func (e *encoder) marshal(tag string, in reflect.Value) {
 		}
 		// fallback case - no number could be obtained
 		in = reflect.ValueOf(m.String())
+	case net.IPNet:
+		in = reflect.ValueOf(m.String())
+	case *net.IPNet:
+		in = reflect.ValueOf(m.String())
+	case big.Int:
+		e.emitScalar(m.String(), "", tag, yaml_PLAIN_SCALAR_STYLE)
+		return
+	case *big.Int:
+		e.emitScalar(m.String(), "", tag, yaml_PLAIN_SCALAR_STYLE)
+		return
+	case big.Float:
+		e.bigFloatv(tag, &m)
+		return
+	case *big.Float:
+		e.bigFloatv(tag, m)
+		return
+	case big.Rat:
+		e.emitScalar(m.RatString(), "", tag, yaml_PLAIN_SCALAR_STYLE)
+		return
+	case *big.Rat:
+		e.emitScalar(m.RatString(), "", tag, yaml_PLAIN_SCALAR_STYLE)
+		return
+	case Set:
+		e.setv(reflect.ValueOf(m))
+		return
+	case Omap:
+		e.pairsv(yaml_OMAP_TAG, m)
+		return
+	case Pairs:
+		e.pairsv(yaml_PAIRS_TAG, m)
+		return
+	case url.URL:
+		in = reflect.ValueOf(m.String())
+	case *url.URL:
+		in = reflect.ValueOf(m.String())
 	case time.Time, *time.Time:
 		// Although time.Time implements TextMarshaler,
 		// we don't want to treat it as a string for YAML
@@ -142,10 +397,23 @@ func (e *encoder) marshal(tag string, in reflect.Value) {
 		e.nilv()
 		return
 	}
+	if e.flow && e.flowWrap == FlowToBlock && !e.json && !e.flowFits && !isScalar(in) {
+		if e.flowLen(in) > e.emitter.best_width {
+			e.flow = false
+		} else {
+			// The collections within in fit as well.
+			e.flowFits = true
+			defer func() { e.flowFits = false }()
+		}
+	}
 	switch in.Kind() {
 	case reflect.Interface:
 		e.marshal(tag, in.Elem())
 	case reflect.Map:
+		if e.null != nil && in.IsNil() {
+			e.nilv()
+			return
+		}
 		e.mapv(tag, in)
 	case reflect.Ptr:
 		if in.Type() == ptrTimeType {
@@ -160,15 +428,21 @@ func (e *encoder) marshal(tag string, in reflect.Value) {
 			e.structv(tag, in)
 		}
 	case reflect.Slice, reflect.Array:
+		if in.Kind() == reflect.Slice && e.null != nil && in.IsNil() {
+			e.nilv()
+			return
+		}
 		if in.Type().Elem() == mapItemType {
 			e.itemsv(tag, in)
+		} else if in.Type().Elem().Kind() == reflect.Uint8 && e.bytes != BytesSequence {
+			e.bytesv(tag, in)
 		} else {
 			e.slicev(tag, in)
 		}
 	case reflect.String:
 		e.stringv(tag, in)
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		if in.Type() == durationType {
+		if in.Type() == durationType && !e.numericDurations {
 			e.stringv(tag, reflect.ValueOf(iface.(time.Duration).String()))
 		} else {
 			e.intv(tag, in)
@@ -180,62 +454,331 @@ func (e *encoder) marshal(tag string, in reflect.Value) {
 	case reflect.Bool:
 		e.boolv(tag, in)
 	default:
+		e.checkKey()
 		panic("cannot marshal type: " + in.Type().String())
 	}
 }
 
 func (e *encoder) mapv(tag string, in reflect.Value) {
+	if e.autoFlow(in) {
+		e.flow = true
+	}
 	e.mappingv(tag, func() {
-		keys := keyList(in.MapKeys())
-		sort.Sort(keys)
+		keys := e.sortedKeys(in)
 		for _, k := range keys {
-			e.marshal("", k)
+			e.marshalKey(k)
 			e.marshal("", in.MapIndex(k))
 		}
 	})
 }
 
+// refKey identifies the value referenced by a pointer or a map.
+type refKey struct {
+	t reflect.Type
+	p uintptr
+}
+
+// refKeyOf returns the key of v if it's a non-nil pointer or map.
+func refKeyOf(v reflect.Value) (refKey, bool) {
+	if (v.Kind() != reflect.Ptr && v.Kind() != reflect.Map) || v.IsNil() {
+		return refKey{}, false
+	}
+	return refKey{v.Type(), v.Pointer()}, true
+}
+
+// countRefs counts in e.refs the references to the pointers and maps
+// reachable from v, following each of them only once.
+func (e *encoder) countRefs(v reflect.Value) {
+	if !v.IsValid() {
+		return
+	}
+	if key, ok := refKeyOf(v); ok {
+		e.refs[key]++
+		if e.refs[key] > 1 {
+			return
+		}
+	}
+	if v.CanInterface() {
+		switch v.Interface().(type) {
+		case Marshaler, encoding.TextMarshaler:
+			return
+		}
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		e.countRefs(v.Elem())
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			e.countRefs(iter.Key())
+			e.countRefs(iter.Value())
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			e.countRefs(v.Index(i))
+		}
+	case reflect.Struct:
+		sinfo, err := getStructInfo(v.Type(), e.jsonTags, e.embedInline)
+		if err != nil {
+			return
+		}
+		for _, info := range sinfo.FieldsList {
+			if info.Inline == nil {
+				e.countRefs(v.Field(info.Num))
+			} else {
+				e.countRefs(v.FieldByIndex(info.Inline))
+			}
+		}
+		if sinfo.InlineMap != nil {
+			e.countRefs(v.FieldByIndex(sinfo.InlineMap))
+		}
+	}
+}
+
+// shared writes an alias and returns true if in is a pointer or map
+// referenced more than once whose value was already written. Otherwise
+// it names the anchor of the next node after the first reference.
+func (e *encoder) shared(in reflect.Value) bool {
+	key, ok := refKeyOf(in)
+	if !ok || e.refs[key] < 2 {
+		return false
+	}
+	if name, ok := e.anchors[key]; ok {
+		e.must(yaml_alias_event_initialize(&e.event, []byte(name)))
+		e.emit()
+		return true
+	}
+	if e.anchor == "" {
+		e.anchor = e.anchorName(len(e.anchors)+1, in.Interface())
+	}
+	e.anchors[key] = e.anchor
+	return false
+}
+
+// takeAnchor returns and clears the anchor of the next node.
+func (e *encoder) takeAnchor() []byte {
+	if e.anchor == "" {
+		return nil
+	}
+	anchor := []byte(e.anchor)
+	e.anchor = ""
+	return anchor
+}
+
+// isEmptyCollection returns whether v is an empty but non-nil slice or
+// map.
+func isEmptyCollection(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return !v.IsNil() && v.Len() == 0
+	}
+	return false
+}
+
+// marshalKey marshals the mapping key k, to which the string style of
+// the struct field being encoded doesn't apply.
+func (e *encoder) marshalKey(k reflect.Value) {
+	if e.json {
+		if !isScalar(k) {
+			failf("cannot marshal map key of type %s as JSON", k.Type())
+		}
+		e.jsonKey = true
+		defer func() { e.jsonKey = false }()
+	}
+	if e.scalarKeys {
+		e.keyType = k.Type()
+		if k.Kind() == reflect.Interface && !k.IsNil() {
+			e.keyType = k.Elem().Type()
+		}
+		defer func() { e.keyType = nil }()
+	}
+	if e.sectionComment != nil && e.depth == 1 && !e.json {
+		e.section(k)
+		e.sections++
+	}
+	style := e.stringStyle
+	e.stringStyle = 0
+	e.marshal("", k)
+	e.stringStyle = style
+}
+
+// section adds the section comment of the top-level key k before the
+// comment of its field, separated from the previous section by a blank
+// line.
+func (e *encoder) section(k reflect.Value) {
+	for k.Kind() == reflect.Interface && !k.IsNil() {
+		k = k.Elem()
+	}
+	var key interface{}
+	if k.IsValid() && k.CanInterface() {
+		key = k.Interface()
+	}
+	text := e.sectionComment(key)
+	if text == "" {
+		return
+	}
+	if e.sections > 0 {
+		text = "\n" + text
+	}
+	if e.comment != "" {
+		text += "\n" + e.comment
+	}
+	e.comment = text
+}
+
+// checkKey fails if a map key is being written and must be a scalar.
+func (e *encoder) checkKey() {
+	if e.keyType != nil {
+		failf("cannot marshal map key of type %s as a scalar", e.keyType)
+	}
+}
+
+// sortedKeys returns the keys of the map in, in the order they are
+// written.
+func (e *encoder) sortedKeys(in reflect.Value) []reflect.Value {
+	keys := in.MapKeys()
+	if e.keyLess == nil {
+		sort.Sort(keyList(keys))
+	} else {
+		sort.Slice(keys, func(i, j int) bool { return e.keyLess(keys[i], keys[j]) })
+	}
+	return keys
+}
+
+// less reports whether the key a is written before the key b.
+func (e *encoder) less(a, b reflect.Value) bool {
+	if e.keyLess == nil {
+		return keyList{a, b}.Less(0, 1)
+	}
+	return e.keyLess(a, b)
+}
+
 func (e *encoder) itemsv(tag string, in reflect.Value) {
+	if e.autoFlow(in) {
+		e.flow = true
+	}
 	e.mappingv(tag, func() {
 		slice := in.Convert(reflect.TypeOf([]MapItem{})).Interface().([]MapItem)
 		for _, item := range slice {
-			e.marshal("", reflect.ValueOf(item.Key))
+			e.marshalKey(reflect.ValueOf(item.Key))
 			e.marshal("", reflect.ValueOf(item.Value))
 		}
 	})
 }
 
+func (e *encoder) setv(in reflect.Value) {
+	e.mappingv(yaml_SET_TAG, func() {
+		keys := e.sortedKeys(in)
+		for _, k := range keys {
+			e.marshalKey(k)
+			e.nilv()
+		}
+	})
+}
+
+func (e *encoder) pairsv(tag string, items []MapItem) {
+	e.checkKey()
+	style := yaml_BLOCK_SEQUENCE_STYLE
+	if e.flow || e.json {
+		e.flow = false
+		style = yaml_FLOW_SEQUENCE_STYLE
+	}
+	implicit := false
+	if e.json {
+		tag, implicit = "", true
+	}
+	e.must(yaml_sequence_start_event_initialize(&e.event, e.takeAnchor(), []byte(tag), implicit, style))
+	e.emit()
+	for _, item := range items {
+		e.mappingv("", func() {
+			e.marshalKey(reflect.ValueOf(item.Key))
+			e.marshal("", reflect.ValueOf(item.Value))
+		})
+	}
+	e.must(yaml_sequence_end_event_initialize(&e.event))
+	e.emit()
+}
+
+// skeletonv writes the zero value of the struct type t in place of a
+// nil pointer to it, or null if t is not a struct type or a struct
+// type being written already.
+func (e *encoder) skeletonv(tag string, t reflect.Type) {
+	if t.Kind() != reflect.Struct || t == timeType || e.expanding[t] {
+		e.nilv()
+		return
+	}
+	if e.expanding == nil {
+		e.expanding = make(map[reflect.Type]bool)
+	}
+	e.expanding[t] = true
+	e.marshal(tag, reflect.New(t))
+	delete(e.expanding, t)
+}
+
+// defaultv writes the default value of the struct field described by
+// info, of type t: as in its tag if it's a scalar, and as decoded into
+// a value of type t otherwise.
+func (e *encoder) defaultv(info fieldInfo, t reflect.Type) {
+	if info.DefaultNode.kind == scalarNode {
+		e.emitScalar(info.Default, "", "", yaml_PLAIN_SCALAR_STYLE)
+		return
+	}
+	def := reflect.New(t).Elem()
+	newDecoder(defaultDecodeOptions).field(info.DefaultNode, info, def)
+	e.marshal("", def)
+}
+
 func (e *encoder) structv(tag string, in reflect.Value) {
-	sinfo, err := getStructInfo(in.Type())
+	sinfo, err := getStructInfo(in.Type(), e.jsonTags, e.embedInline)
 	if err != nil {
-		panic(err)
+		fail(err)
+	}
+	fields := sinfo.FieldsList
+	if e.sortFields {
+		fields = append([]fieldInfo(nil), fields...)
+		sort.SliceStable(fields, func(i, j int) bool {
+			return e.less(reflect.ValueOf(fields[i].Key), reflect.ValueOf(fields[j].Key))
+		})
 	}
 	e.mappingv(tag, func() {
-		for _, info := range sinfo.FieldsList {
+		for _, info := range fields {
 			var value reflect.Value
 			if info.Inline == nil {
 				value = in.Field(info.Num)
 			} else {
 				value = in.FieldByIndex(info.Inline)
 			}
-			if info.OmitEmpty && isZero(value) {
+			if !e.skeleton && (info.OmitEmpty && isZero(value) && !(e.explicitEmpty && isEmptyCollection(value)) ||
+				info.OmitZero && isZeroValue(value)) {
 				continue
 			}
-			e.marshal("", reflect.ValueOf(info.Key))
+			e.comment = info.Comment
+			e.marshalKey(reflect.ValueOf(info.Key))
 			e.flow = info.Flow
-			e.marshal("", value)
+			e.timeFormat = info.Format
+			stringStyle, bytes := e.stringStyle, e.bytes
+			e.stringStyle = info.Style
+			if info.Bytes != 0 {
+				e.bytes = info.Bytes
+			}
+			if e.skeleton && info.Default != "" && isZeroValue(value) {
+				e.defaultv(info, value.Type())
+			} else {
+				e.marshal("", value)
+			}
+			e.stringStyle, e.bytes = stringStyle, bytes
+			e.timeFormat = ""
 		}
-		if sinfo.InlineMap >= 0 {
-			m := in.Field(sinfo.InlineMap)
+		if sinfo.InlineMap != nil {
+			m := in.FieldByIndex(sinfo.InlineMap)
 			if m.Len() > 0 {
 				e.flow = false
-				keys := keyList(m.MapKeys())
-				sort.Sort(keys)
+				keys := e.sortedKeys(m)
 				for _, k := range keys {
 					if _, found := sinfo.FieldsMap[k.String()]; found {
-						panic(fmt.Sprintf("Can't have key %q in inlined map; conflicts with struct field", k.String()))
+						fail(&StructError{Type: in.Type(), Key: k.String(), Msg: fmt.Sprintf("Can't have key %q in inlined map; conflicts with struct field", k.String())})
 					}
-					e.marshal("", k)
+					e.marshalKey(k)
 					e.flow = false
 					e.marshal("", m.MapIndex(k))
 				}
@@ -245,36 +788,170 @@ func (e *encoder) structv(tag string, in reflect.Value) {
 }
 
 func (e *encoder) mappingv(tag string, f func()) {
+	e.checkKey()
 	implicit := tag == ""
+	if e.allTags() && implicit {
+		tag, implicit = yaml_MAP_TAG, false
+	}
 	style := yaml_BLOCK_MAPPING_STYLE
-	if e.flow {
+	if e.flow || e.json {
 		e.flow = false
 		style = yaml_FLOW_MAPPING_STYLE
 	}
-	yaml_mapping_start_event_initialize(&e.event, nil, []byte(tag), implicit, style)
+	if e.json {
+		tag, implicit = "", true
+	}
+	yaml_mapping_start_event_initialize(&e.event, e.takeAnchor(), []byte(tag), implicit, style)
 	e.emit()
+	if e.depth == 0 {
+		e.sections = 0
+	}
+	e.depth++
 	f()
+	e.depth--
 	yaml_mapping_end_event_initialize(&e.event)
 	e.emit()
 }
 
 func (e *encoder) slicev(tag string, in reflect.Value) {
+	e.checkKey()
 	implicit := tag == ""
+	if e.allTags() && implicit {
+		tag, implicit = yaml_SEQ_TAG, false
+	}
 	style := yaml_BLOCK_SEQUENCE_STYLE
-	if e.flow {
+	if e.flow || e.json || e.autoFlow(in) {
 		e.flow = false
 		style = yaml_FLOW_SEQUENCE_STYLE
 	}
-	e.must(yaml_sequence_start_event_initialize(&e.event, nil, []byte(tag), implicit, style))
+	if e.json {
+		tag, implicit = "", true
+	}
+	e.must(yaml_sequence_start_event_initialize(&e.event, e.takeAnchor(), []byte(tag), implicit, style))
 	e.emit()
+	e.depth++
 	n := in.Len()
 	for i := 0; i < n; i++ {
 		e.marshal("", in.Index(i))
 	}
+	e.depth--
 	e.must(yaml_sequence_end_event_initialize(&e.event))
 	e.emit()
 }
 
+// autoFlow reports whether the map or sequence in is written in flow
+// style because it's nested in another collection, holds only scalars
+// and its flow encoding is no longer than the flow width.
+func (e *encoder) autoFlow(in reflect.Value) bool {
+	if e.flow || e.flowWidth <= 0 || e.depth == 0 || !holdsScalars(in) {
+		return false
+	}
+	return e.flowLen(in) <= e.flowWidth
+}
+
+// flowLen returns the length of in when written in flow style on a
+// single line, with the settings of e.
+func (e *encoder) flowLen(in reflect.Value) int {
+	sub := *e
+	sub.emitter = yaml_emitter_t{}
+	yaml_emitter_initialize(&sub.emitter)
+	defer sub.destroy()
+	yaml_emitter_set_output_string(&sub.emitter, &sub.out)
+	yaml_emitter_set_unicode(&sub.emitter, e.emitter.unicode)
+	yaml_emitter_set_canonical(&sub.emitter, e.emitter.canonical)
+	yaml_emitter_set_width(&sub.emitter, -1)
+	sub.event = yaml_event_t{}
+	sub.out = nil
+	sub.doneInit = false
+	sub.inSeq = false
+	sub.depth = 0
+	sub.anchor = ""
+	sub.comment = ""
+	sub.sectionComment = nil
+	sub.keyType = nil
+	sub.jsonKey = false
+	sub.version, sub.tagDirectives = nil, nil
+	sub.markers = MarkBetween
+	sub.flowWrap = FlowOneLine
+	sub.flow = true
+	sub.marshalDoc("", in)
+	sub.finish()
+	return len(bytes.TrimSpace(sub.out))
+}
+
+// holdsScalars returns whether the keys and values of the map or
+// sequence in are all encoded as scalars.
+func holdsScalars(in reflect.Value) bool {
+	switch in.Kind() {
+	case reflect.Map:
+		iter := in.MapRange()
+		for iter.Next() {
+			if !isScalar(iter.Key()) || !isScalar(iter.Value()) {
+				return false
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if in.Type().Elem() == mapItemType {
+			for i := 0; i < in.Len(); i++ {
+				item := in.Index(i).Interface().(MapItem)
+				if !isScalar(reflect.ValueOf(item.Key)) || !isScalar(reflect.ValueOf(item.Value)) {
+					return false
+				}
+			}
+			return true
+		}
+		for i := 0; i < in.Len(); i++ {
+			if !isScalar(in.Index(i)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isScalar returns whether v is encoded as a scalar, judging by its kind.
+func isScalar(v reflect.Value) bool {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return false
+	case reflect.Struct:
+		return v.Type() == timeType
+	}
+	return true
+}
+
+// bytesv writes the byte slice or array in in the encoder's bytes
+// format.
+func (e *encoder) bytesv(tag string, in reflect.Value) {
+	b := make([]byte, in.Len())
+	reflect.Copy(reflect.ValueOf(b), in)
+	switch e.bytes {
+	case BytesBase64:
+		if tag == "" {
+			tag = yaml_BINARY_TAG
+		}
+		s := encodeBase64(string(b))
+		style := yaml_PLAIN_SCALAR_STYLE
+		if strings.Contains(s, "\n") {
+			style = yaml_LITERAL_SCALAR_STYLE
+		}
+		e.emitScalar(s, "", tag, style)
+	case BytesHex:
+		e.stringv(tag, reflect.ValueOf(hex.EncodeToString(b)))
+	default:
+		e.stringv(tag, reflect.ValueOf(string(b)))
+	}
+}
+
 // isBase60 returns whether s is in base 60 notation as defined in YAML 1.1.
 //
 // The base 60 float notation in YAML 1.1 is a terrible idea and is unsupported
@@ -317,17 +994,36 @@ func (e *encoder) stringv(tag string, in reflect.Value) {
 		// Check to see if it would resolve to a specific
 		// tag when encoded unquoted. If it doesn't,
 		// there's no need to quote it.
-		rtag, _ := resolve("", s)
+		var rtag string
+		if e.schema == SchemaCore {
+			rtag, _ = resolveCore("", s)
+		} else {
+			rtag, _ = resolve("", s)
+		}
 		canUsePlain = rtag == yaml_STR_TAG && !isBase60Float(s)
+		if canUsePlain && e.quoting == QuoteSafe {
+			if e.schema == SchemaCore {
+				rtag, _ = resolve("", s)
+			} else {
+				rtag, _ = resolveCore("", s)
+			}
+			canUsePlain = rtag == yaml_STR_TAG
+		}
 	}
 	// Note: it's possible for user code to emit invalid YAML
 	// if they explicitly specify a tag and a string containing
 	// text that's incompatible with that tag.
 	switch {
+	case e.stringStyle != 0:
+		style = e.stringStyle
+	case strings.Contains(s, "\n") && e.multiline != 0:
+		style = e.multiline
 	case strings.Contains(s, "\n"):
 		style = yaml_LITERAL_SCALAR_STYLE
-	case canUsePlain:
+	case canUsePlain && e.quoting != QuoteAlways:
 		style = yaml_PLAIN_SCALAR_STYLE
+	case e.quoteStyle != 0:
+		style = e.quoteStyle
 	default:
 		style = yaml_DOUBLE_QUOTED_SCALAR_STYLE
 	}
@@ -356,10 +1052,32 @@ func (e *encoder) uintv(tag string, in reflect.Value) {
 
 func (e *encoder) timev(tag string, in reflect.Value) {
 	t := in.Interface().(time.Time)
+	if e.timeFormat != "" {
+		s := t.Format(e.timeFormat)
+		if rtag, _ := resolve("", s); rtag != yaml_TIMESTAMP_TAG {
+			e.stringv(tag, reflect.ValueOf(s))
+			return
+		}
+		e.emitScalar(s, "", tag, yaml_PLAIN_SCALAR_STYLE)
+		return
+	}
 	s := t.Format(time.RFC3339Nano)
 	e.emitScalar(s, "", tag, yaml_PLAIN_SCALAR_STYLE)
 }
 
+func (e *encoder) bigFloatv(tag string, f *big.Float) {
+	var s string
+	switch {
+	case f.IsInf() && f.Signbit():
+		s = "-.inf"
+	case f.IsInf():
+		s = ".inf"
+	default:
+		s = f.Text('g', -1)
+	}
+	e.emitScalar(s, "", tag, yaml_PLAIN_SCALAR_STYLE)
+}
+
 func (e *encoder) floatv(tag string, in reflect.Value) {
 	// Issue #352: When formatting, use the precision of the underlying value
 	precision := 64
@@ -367,7 +1085,11 @@ func (e *encoder) floatv(tag string, in reflect.Value) {
 		precision = 32
 	}
 
-	s := strconv.FormatFloat(in.Float(), 'g', -1, precision)
+	format, prec := byte('g'), -1
+	if e.floatFormat != 0 {
+		format, prec = e.floatFormat, e.floatPrec
+	}
+	s := strconv.FormatFloat(in.Float(), format, prec, precision)
 	switch s {
 	case "+Inf":
 		s = ".inf"
@@ -375,16 +1097,71 @@ func (e *encoder) floatv(tag string, in reflect.Value) {
 		s = "-.inf"
 	case "NaN":
 		s = ".nan"
+	default:
+		if e.floatPoint && !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
 	}
 	e.emitScalar(s, "", tag, yaml_PLAIN_SCALAR_STYLE)
 }
 
+// jsonStyle returns the style of the scalar value, written in the
+// given style, in JSON output: plain for numbers, booleans and null,
+// except as mapping keys, and double-quoted for anything else.
+func (e *encoder) jsonStyle(value string, style yaml_scalar_style_t) yaml_scalar_style_t {
+	if style != yaml_PLAIN_SCALAR_STYLE || e.jsonKey {
+		return yaml_DOUBLE_QUOTED_SCALAR_STYLE
+	}
+	switch value {
+	case "true", "false", "null":
+		return style
+	case ".inf", "-.inf", ".nan":
+		failf("cannot marshal %s as JSON", value)
+	}
+	if jsonNumberRE.MatchString(value) {
+		return style
+	}
+	return yaml_DOUBLE_QUOTED_SCALAR_STYLE
+}
+
+var jsonNumberRE = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
 func (e *encoder) nilv() {
-	e.emitScalar("null", "", "", yaml_PLAIN_SCALAR_STYLE)
+	null := "null"
+	if e.null != nil && !e.json {
+		null = *e.null
+	}
+	e.emitScalar(null, "", "", yaml_PLAIN_SCALAR_STYLE)
+}
+
+// allTags returns whether the tags of all nodes are written out.
+func (e *encoder) allTags() bool {
+	return e.canonical || e.explicitTags && !e.json
 }
 
 func (e *encoder) emitScalar(value, anchor, tag string, style yaml_scalar_style_t) {
+	e.keyType = nil
+	if anchor == "" {
+		anchor = string(e.takeAnchor())
+	}
+	if e.json {
+		tag, style = "", e.jsonStyle(value, style)
+	}
 	implicit := tag == ""
+	if e.allTags() && implicit {
+		tag, implicit = yaml_STR_TAG, false
+		if style == yaml_PLAIN_SCALAR_STYLE {
+			if e.schema == SchemaCore {
+				tag, _ = resolveCore("", value)
+			} else {
+				tag, _ = resolve("", value)
+			}
+		}
+	}
 	e.must(yaml_scalar_event_initialize(&e.event, []byte(anchor), []byte(tag), []byte(value), implicit, implicit, style))
+	if e.comment != "" {
+		e.event.head_comment = []byte(e.comment)
+		e.comment = ""
+	}
 	e.emit()
 }
@@ -2,6 +2,7 @@ package yaml_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"math"
 	"strconv"
@@ -462,6 +463,823 @@ func (s *S) TestEncoderWriteError(c *C) {
 	c.Assert(err, ErrorMatches, `yaml: write error: some write error`) // Data not flushed yet
 }
 
+func (s *S) TestEncoderSchemaCore(c *C) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetSchema(yaml.SchemaCore)
+	err := enc.Encode([]string{"yes", "on", "1_000", "0755", "true", "12"})
+	c.Assert(err, Equals, nil)
+	c.Assert(enc.Close(), Equals, nil)
+	c.Assert(buf.String(), Equals, "- yes\n- on\n- 1_000\n- \"0755\"\n- \"true\"\n- \"12\"\n")
+}
+
+func (s *S) TestMarshalTimeFormat(c *C) {
+	day := time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC)
+	v := struct {
+		A time.Time   `yaml:"a,format=02/01/2006"`
+		B []time.Time `yaml:"b,format=2006-01-02"`
+		C time.Time   `yaml:"c"`
+	}{day, []time.Time{day}, day}
+	data, err := yaml.Marshal(&v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: 14/10/2026\nb:\n- 2026-10-14\nc: 2026-10-14T09:30:00Z\n")
+}
+
+func (s *S) TestMarshalSetAndOmap(c *C) {
+	v := map[string]interface{}{
+		"a": yaml.Set{"x": {}, "z": {}},
+		"b": yaml.Omap{{"z", 1}, {"a", 2}},
+		"c": yaml.Pairs{{"a", 1}, {"a", 2}},
+	}
+	data, err := yaml.Marshal(v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: !!set\n  x: null\n  z: null\nb: !!omap\n- z: 1\n- a: 2\nc: !!pairs\n- a: 1\n- a: 2\n")
+
+	var back map[string]interface{}
+	c.Assert(yaml.Unmarshal(data, &back), IsNil)
+	c.Assert(back, DeepEquals, v)
+}
+
+func (s *S) TestEncoderJSONTags(c *C) {
+	type T struct {
+		Name  string `json:"name_field"`
+		Count int    `json:"count,omitempty"`
+		Both  int    `json:"json_key" yaml:"yaml_key"`
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetJSONTags(true)
+	c.Assert(enc.Encode(T{Name: "a", Both: 1}), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "name_field: a\nyaml_key: 1\n")
+}
+
+func (s *S) TestEncoderInlineEmbedded(c *C) {
+	type Base struct{ ID int }
+	type Meta struct{ Owner string }
+	type T struct {
+		Base
+		Meta `yaml:"meta"`
+		Name string
+	}
+	v := T{Base{1}, Meta{"me"}, "a"}
+	data, err := yaml.Marshal(v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "base:\n  id: 1\nmeta:\n  owner: me\nname: a\n")
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetInlineEmbedded(true)
+	c.Assert(enc.Encode(v), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "id: 1\nmeta:\n  owner: me\nname: a\n")
+
+	type Named struct{ Name, Kind string }
+	type Other struct{ Kind string }
+	type U struct {
+		Named
+		Other
+		Name string
+	}
+	buf.Reset()
+	enc = yaml.NewEncoder(&buf)
+	enc.SetInlineEmbedded(true)
+	c.Assert(enc.Encode(U{Named{"x", "y"}, Other{"z"}, "a"}), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "name: a\n")
+}
+
+func (s *S) TestEncoderIndent(c *C) {
+	v := yaml.MapSlice{{"a", []interface{}{1, map[string]interface{}{"b": 1, "c": []int{2}}}}, {"d", map[string]int{"e": 3}}}
+	for _, t := range []struct {
+		spaces int
+		seqs   bool
+		want   string
+	}{
+		{2, false, "a:\n- 1\n- b: 1\n  c:\n  - 2\nd:\n  e: 3\n"},
+		{2, true, "a:\n  - 1\n  - b: 1\n    c:\n      - 2\nd:\n  e: 3\n"},
+		{4, false, "a:\n- 1\n- b: 1\n  c:\n  - 2\nd:\n    e: 3\n"},
+		{4, true, "a:\n    - 1\n    - b: 1\n      c:\n        - 2\nd:\n    e: 3\n"},
+	} {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(t.spaces)
+		enc.SetIndentSequences(t.seqs)
+		c.Assert(enc.Encode(v), IsNil)
+		c.Assert(enc.Close(), IsNil)
+		c.Assert(buf.String(), Equals, t.want, Commentf("spaces %d, sequences %v", t.spaces, t.seqs))
+	}
+}
+
+func (s *S) TestEncoderFlowWidth(c *C) {
+	type T struct {
+		Name   string
+		Labels map[string]string
+		Ports  []int
+		Args   []string `yaml:",flow"`
+		Nested map[string][]int
+		Long   []string
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetFlowWidth(24)
+	c.Assert(enc.Encode(T{
+		Name:   "web",
+		Labels: map[string]string{"app": "web", "tier": "front"},
+		Ports:  []int{80, 443},
+		Args:   []string{"a", "b"},
+		Nested: map[string][]int{"x": {1}},
+		Long:   []string{"a long string", "and another"},
+	}), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "name: web\n"+
+		"labels: {app: web, tier: front}\n"+
+		"ports: [80, 443]\n"+
+		"args: [a, b]\n"+
+		"nested:\n  x: [1]\n"+
+		"long:\n- a long string\n- and another\n")
+
+	buf.Reset()
+	enc = yaml.NewEncoder(&buf)
+	enc.SetFlowWidth(12)
+	enc.SetQuoting(yaml.QuoteAlways)
+	c.Assert(enc.Encode(map[string][]string{"a": {"x"}, "b": {"abc", "de"}}), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "\"a\": [\"x\"]\n\"b\":\n- \"abc\"\n- \"de\"\n")
+}
+
+func (s *S) TestMarshalComments(c *C) {
+	type Server struct {
+		Host string `yaml:"host,comment=Host name, or IP address"`
+		Port int    `yaml:"port,omitempty,comment=The TCP port to listen on"`
+	}
+	type T struct {
+		Server  Server   `yaml:"server,comment=Server settings\nused at startup"`
+		Servers []Server `yaml:"servers"`
+		Flow    Server   `yaml:"flow,flow"`
+	}
+	data, err := yaml.Marshal(T{Server: Server{"a", 80}, Servers: []Server{{"b", 0}}, Flow: Server{"c", 1}})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "# Server settings\n# used at startup\nserver:\n"+
+		"  # Host name, or IP address\n  host: a\n  # The TCP port to listen on\n  port: 80\n"+
+		"servers:\n# Host name, or IP address\n- host: b\n"+
+		"flow: {host: c, port: 1}\n")
+
+	var back T
+	c.Assert(yaml.Unmarshal(data, &back), IsNil)
+	c.Assert(back.Server, Equals, Server{"a", 80})
+	c.Assert(back.Servers, DeepEquals, []Server{{"b", 0}})
+
+	data, err = yaml.Marshal([][]Server{{{"a", 80}}})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "# Host name, or IP address\n- - host: a\n"+
+		"    # The TCP port to listen on\n    port: 80\n")
+}
+
+func (s *S) TestEncoderKeyOrder(c *C) {
+	m := map[string]int{"a10": 1, "a2": 2, "B": 3}
+	type T struct {
+		Z int
+		M map[string]int
+		A int
+	}
+	for _, t := range []struct {
+		setup func(enc *yaml.Encoder)
+		want  string
+	}{
+		{func(enc *yaml.Encoder) {}, "z: 0\nm:\n  B: 3\n  a2: 2\n  a10: 1\na: 0\n"},
+		{func(enc *yaml.Encoder) { enc.SetKeyOrder(yaml.LexicalOrder) }, "z: 0\nm:\n  B: 3\n  a10: 1\n  a2: 2\na: 0\n"},
+		{func(enc *yaml.Encoder) {
+			enc.SetKeyLess(func(a, b interface{}) bool { return a.(string) > b.(string) })
+		}, "z: 0\nm:\n  a2: 2\n  a10: 1\n  B: 3\na: 0\n"},
+		{func(enc *yaml.Encoder) { enc.SetSortFields(true) }, "a: 0\nm:\n  B: 3\n  a2: 2\n  a10: 1\nz: 0\n"},
+	} {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		t.setup(enc)
+		c.Assert(enc.Encode(T{M: m}), IsNil)
+		c.Assert(enc.Close(), IsNil)
+		c.Assert(buf.String(), Equals, t.want)
+	}
+}
+
+type zeroWrapper struct{ set bool }
+
+func (w zeroWrapper) IsZero() bool { return !w.set }
+
+func (s *S) TestMarshalOmitZero(c *C) {
+	type T struct {
+		Int     int               `yaml:",omitzero"`
+		Slice   []int             `yaml:",omitzero"`
+		Map     map[string]int    `yaml:",omitzero"`
+		Ptr     *int              `yaml:",omitzero"`
+		Wrapper zeroWrapper       `yaml:",omitzero"`
+		Time    time.Time         `yaml:",omitzero"`
+		Empty   []int             `yaml:",omitempty"`
+		Both    map[string]string `yaml:",omitempty,omitzero"`
+	}
+	data, err := yaml.Marshal(T{})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "{}\n")
+
+	zero := 0
+	data, err = yaml.Marshal(T{Slice: []int{}, Map: map[string]int{}, Ptr: &zero, Wrapper: zeroWrapper{true}, Empty: []int{}, Both: map[string]string{}})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "slice: []\nmap: {}\nptr: 0\nwrapper: {}\n")
+}
+
+type ptrZeroer struct{ Value *int }
+
+func (o *ptrZeroer) IsZero() bool { return o.Value == nil }
+
+func (s *S) TestMarshalOmitEmptyPtrIsZero(c *C) {
+	type T struct {
+		Created time.Time `yaml:"created,omitempty"`
+		Option  ptrZeroer `yaml:"option,omitempty"`
+		Other   ptrZeroer `yaml:"other,omitzero"`
+	}
+	data, err := yaml.Marshal(T{})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "{}\n")
+	data, err = yaml.Marshal(&T{})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "{}\n")
+
+	one := 1
+	data, err = yaml.Marshal(T{Option: ptrZeroer{&one}})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "option:\n  value: 1\n")
+}
+
+func (s *S) TestEncoderAutoAnchors(c *C) {
+	type Node struct {
+		Name string
+		Next *Node `yaml:",omitempty"`
+	}
+	shared := &Node{Name: "s"}
+	cycle := &Node{Name: "c"}
+	cycle.Next = cycle
+	v := []*Node{{Name: "a", Next: shared}, {Name: "b", Next: shared}, cycle}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetAutoAnchors(true, nil)
+	c.Assert(enc.Encode(v), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "- name: a\n  next: &a1\n    name: s\n- name: b\n  next: *a1\n- &a2\n  name: c\n  next: *a2\n")
+
+	buf.Reset()
+	enc = yaml.NewEncoder(&buf)
+	enc.SetAutoAnchors(true, func(n int, v interface{}) string {
+		return v.(*Node).Name
+	})
+	c.Assert(enc.Encode(v[:2]), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "- name: a\n  next: &s\n    name: s\n- name: b\n  next: *s\n")
+
+	var back []Node
+	c.Assert(yaml.Unmarshal(buf.Bytes(), &back), IsNil)
+	c.Assert(back[1].Next, DeepEquals, &Node{Name: "s"})
+}
+
+func (s *S) TestMarshalMultilineStyles(c *C) {
+	type T struct {
+		Script string            `yaml:"script"`
+		Desc   string            `yaml:"desc,folded"`
+		Names  map[string]string `yaml:"names,literal"`
+	}
+	v := T{Script: "echo hi\nexit 1\n", Desc: "some\ntext", Names: map[string]string{"k": "v"}}
+	data, err := yaml.Marshal(v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "script: |\n  echo hi\n  exit 1\ndesc: >-\n  some\n\n  text\nnames:\n  k: |-\n    v\n")
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetMultilineStyle(yaml.DoubleQuotedStyle)
+	c.Assert(enc.Encode(v), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "script: \"echo hi\\nexit 1\\n\"\ndesc: >-\n  some\n\n  text\nnames:\n  k: |-\n    v\n")
+
+	var back T
+	c.Assert(yaml.Unmarshal(data, &back), IsNil)
+	c.Assert(back, DeepEquals, v)
+
+	_, err = yaml.Marshal(&struct {
+		A string `yaml:"a,literal,folded"`
+	}{})
+	c.Assert(err, ErrorMatches, "Flags literal and folded are exclusive .*")
+}
+
+func (s *S) TestEncoderLineWidth(c *C) {
+	v := map[string]string{"a": strings.Repeat("word ", 20)[:99]}
+	for _, t := range []struct {
+		width int
+		lines int
+	}{{0, 1}, {-1, 1}, {40, 3}, {1000, 1}} {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetLineWidth(t.width)
+		c.Assert(enc.Encode(v), IsNil)
+		c.Assert(enc.Close(), IsNil)
+		c.Assert(strings.Count(buf.String(), "\n"), Equals, t.lines, Commentf("width %d: %q", t.width, buf.String()))
+	}
+}
+
+func (s *S) TestEncoderQuoting(c *C) {
+	v := yaml.MapSlice{{"a", "no"}, {"b", "1e2"}, {"c", "plain"}, {"d", "it's"}}
+	for _, t := range []struct {
+		quoting yaml.Quoting
+		single  bool
+		want    string
+	}{
+		{yaml.QuoteWhenNeeded, false, "a: no\nb: \"1e2\"\nc: plain\nd: it's\n"},
+		{yaml.QuoteSafe, false, "a: \"no\"\nb: \"1e2\"\nc: plain\nd: it's\n"},
+		{yaml.QuoteSafe, true, "a: 'no'\nb: '1e2'\nc: plain\nd: it's\n"},
+		{yaml.QuoteAlways, true, "'a': 'no'\n'b': '1e2'\n'c': 'plain'\n'd': 'it''s'\n"},
+	} {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetSchema(yaml.SchemaCore)
+		enc.SetQuoting(t.quoting)
+		if t.single {
+			enc.SetQuoteStyle(yaml.SingleQuotedStyle)
+		}
+		c.Assert(enc.Encode(v), IsNil)
+		c.Assert(enc.Close(), IsNil)
+		c.Assert(buf.String(), Equals, t.want)
+	}
+}
+
+func (s *S) TestEncoderCanonical(c *C) {
+	v := yaml.MapSlice{{"a", "no"}, {"b", []interface{}{1, true, nil}}}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetCanonical(true)
+	enc.SetQuoting(yaml.QuoteAlways)
+	c.Assert(enc.Encode(v), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "---\n!!map {\n"+
+		"  ? !!str \"a\"\n  : !!str \"no\",\n"+
+		"  ? !!str \"b\"\n  : !!seq [\n    !!int \"1\",\n    !!bool \"true\",\n    !!null \"null\",\n  ],\n}\n")
+
+	var back map[string]interface{}
+	c.Assert(yaml.Unmarshal(buf.Bytes(), &back), IsNil)
+	c.Assert(back, DeepEquals, map[string]interface{}{"a": "no", "b": []interface{}{1, true, nil}})
+}
+
+func (s *S) TestEncoderJSONCompatible(c *C) {
+	type T struct {
+		Name   string `yaml:"name,comment=The name"`
+		Script string `yaml:"script,literal"`
+	}
+	shared := &T{Name: "n", Script: "s\n"}
+	v := yaml.MapSlice{{"a", "no"}, {1, []interface{}{1.5, true, nil}}, {"t", shared}, {"u", shared}, {"set", yaml.Set{"x": {}}}}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetJSONCompatible(true)
+	enc.SetAutoAnchors(true, nil)
+	enc.SetLineWidth(-1)
+	c.Assert(enc.Encode(v), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, `{"a": "no", "1": [1.5, true, null], "t": {"name": "n", "script": "s\n"}, `+
+		`"u": {"name": "n", "script": "s\n"}, "set": {"x": null}}`+"\n")
+
+	var back map[string]interface{}
+	c.Assert(json.Unmarshal(buf.Bytes(), &back), IsNil)
+	c.Assert(back["1"], DeepEquals, []interface{}{1.5, true, nil})
+
+	enc = yaml.NewEncoder(&buf)
+	enc.SetJSONCompatible(true)
+	c.Assert(enc.Encode(math.Inf(1)), ErrorMatches, "yaml: cannot marshal .inf as JSON")
+}
+
+func (s *S) TestEncoderDocumentMarkers(c *C) {
+	for _, t := range []struct {
+		markers yaml.DocumentMarkers
+		want    string
+	}{
+		{yaml.MarkBetween, "a: 1\n---\n- 1\n"},
+		{yaml.MarkStart, "---\na: 1\n---\n- 1\n"},
+		{yaml.MarkStartEnd, "---\na: 1\n...\n---\n- 1\n...\n"},
+		{yaml.MarkNone, "a: 1\n- 1\n"},
+	} {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetDocumentMarkers(t.markers)
+		c.Assert(enc.Encode(map[string]int{"a": 1}), IsNil)
+		c.Assert(enc.Encode([]int{1}), IsNil)
+		c.Assert(enc.Close(), IsNil)
+		c.Assert(buf.String(), Equals, t.want)
+	}
+}
+
+func (s *S) TestEncoderNullValue(c *C) {
+	type T struct {
+		P *int
+		M map[string]int
+		S []int
+		I interface{}
+		F []*int `yaml:",flow"`
+	}
+	v := T{F: []*int{nil}}
+	for _, t := range []struct {
+		null string
+		want string
+	}{
+		{"null", "p: null\nm: null\ns: null\ni: null\nf: [null]\n"},
+		{"~", "p: ~\nm: ~\ns: ~\ni: ~\nf: [~]\n"},
+		{"", "p:\nm:\ns:\ni:\nf: [null]\n"},
+	} {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetNullValue(t.null)
+		c.Assert(enc.Encode(v), IsNil)
+		c.Assert(enc.Close(), IsNil)
+		c.Assert(buf.String(), Equals, t.want)
+
+		var back T
+		c.Assert(yaml.Unmarshal(buf.Bytes(), &back), IsNil)
+		c.Assert(back, DeepEquals, v)
+	}
+	c.Assert(func() { yaml.NewEncoder(nil).SetNullValue("nil") }, PanicMatches, `yaml: "nil" is not a null value`)
+}
+
+func (s *S) TestEncoderNumericDurations(c *C) {
+	v := map[string]time.Duration{"d": 90 * time.Minute}
+	data, err := yaml.Marshal(v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "d: 1h30m0s\n")
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetNumericDurations(true)
+	c.Assert(enc.Encode(v), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "d: 5400000000000\n")
+
+	var back map[string]time.Duration
+	c.Assert(yaml.Unmarshal(buf.Bytes(), &back), IsNil)
+	c.Assert(back, DeepEquals, v)
+}
+
+func (s *S) TestEncoderExplicitEmpty(c *C) {
+	type T struct {
+		List    []string          `yaml:"list,omitempty"`
+		Map     map[string]string `yaml:"map,omitempty"`
+		Absent  []string          `yaml:"absent,omitempty"`
+		Default []string          `yaml:"default"`
+	}
+	v := T{List: []string{}, Map: map[string]string{}}
+	data, err := yaml.Marshal(v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "default: []\n")
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetExplicitEmpty(true)
+	c.Assert(enc.Encode(v), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "list: []\nmap: {}\ndefault: []\n")
+}
+
+func (s *S) TestEncoderFloatFormat(c *C) {
+	v := yaml.MapSlice{{"a", 1.0}, {"b", 1e21}, {"c", 0.125}, {"d", float32(2)}}
+	for _, t := range []struct {
+		format byte
+		prec   int
+		point  bool
+		want   string
+	}{
+		{0, 0, false, "a: 1\nb: 1e+21\nc: 0.125\nd: 2\n"},
+		{0, 0, true, "a: 1.0\nb: 1e+21\nc: 0.125\nd: 2.0\n"},
+		{'f', -1, true, "a: 1.0\nb: 1000000000000000000000.0\nc: 0.125\nd: 2.0\n"},
+		{'f', 2, false, "a: 1.00\nb: 1000000000000000000000.00\nc: 0.12\nd: 2.00\n"},
+	} {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		if t.format != 0 {
+			enc.SetFloatFormat(t.format, t.prec)
+		}
+		enc.SetFloatPoint(t.point)
+		c.Assert(enc.Encode(v), IsNil)
+		c.Assert(enc.Close(), IsNil)
+		c.Assert(buf.String(), Equals, t.want)
+
+		var back map[string]interface{}
+		c.Assert(yaml.Unmarshal(buf.Bytes(), &back), IsNil)
+		if t.point {
+			c.Assert(back["a"], Equals, 1.0)
+		}
+	}
+	c.Assert(func() { yaml.NewEncoder(nil).SetFloatFormat('x', 0) }, PanicMatches, `yaml: invalid float format 'x'`)
+}
+
+func (s *S) TestEncoderBytesFormat(c *C) {
+	type T struct {
+		Data []byte
+		Key  []byte `yaml:"key,bytes=hex"`
+		Raw  []byte `yaml:"raw,bytes=string"`
+	}
+	v := T{Data: []byte("hi"), Key: []byte{0xde, 0xad}, Raw: []byte("\xff")}
+	for _, t := range []struct {
+		format yaml.BytesFormat
+		want   string
+	}{
+		{yaml.BytesSequence, "data:\n- 104\n- 105\nkey: dead\nraw: !!binary /w==\n"},
+		{yaml.BytesBase64, "data: !!binary aGk=\nkey: dead\nraw: !!binary /w==\n"},
+		{yaml.BytesHex, "data: \"6869\"\nkey: dead\nraw: !!binary /w==\n"},
+		{yaml.BytesString, "data: hi\nkey: dead\nraw: !!binary /w==\n"},
+	} {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetBytesFormat(t.format)
+		c.Assert(enc.Encode(v), IsNil)
+		c.Assert(enc.Close(), IsNil)
+		c.Assert(buf.String(), Equals, t.want)
+
+		var back T
+		dec := yaml.NewDecoder(&buf)
+		dec.SetBytesFormat(t.format)
+		c.Assert(dec.Decode(&back), IsNil)
+		c.Assert(back, DeepEquals, v)
+	}
+}
+
+func (s *S) TestEncoderSeq(c *C) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	c.Assert(enc.EncodeItem(1), ErrorMatches, "yaml: no sequence open")
+	c.Assert(enc.Encode("a"), IsNil)
+	c.Assert(enc.BeginSeq(), IsNil)
+	c.Assert(enc.Encode("b"), ErrorMatches, "yaml: cannot encode a document while a sequence is open")
+	c.Assert(enc.EncodeItem(map[string]int{"a": 1}), IsNil)
+	// The line break is written with the next item.
+	c.Assert(buf.String(), Equals, "a\n---\n- a: 1")
+	c.Assert(enc.EncodeItem([]int{2}), IsNil)
+	c.Assert(enc.EndSeq(), IsNil)
+	c.Assert(enc.EndSeq(), ErrorMatches, "yaml: no sequence open")
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "a\n---\n- a: 1\n- - 2\n")
+}
+
+func (s *S) TestMarshalAppend(c *C) {
+	out, err := yaml.MarshalAppend([]byte("# head\n"), map[string]int{"a": 1})
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "# head\na: 1\n")
+}
+
+func (s *S) TestEncoderReset(c *C) {
+	var buf1, buf2 bytes.Buffer
+	enc := yaml.NewEncoder(&buf1)
+	enc.SetIndent(4)
+	c.Assert(enc.Encode(map[string][]int{"a": {1}}), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	enc.Reset(&buf2)
+	c.Assert(enc.Encode(map[string]map[string]int{"b": {"c": 2}}), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf1.String(), Equals, "a:\n- 1\n")
+	c.Assert(buf2.String(), Equals, "b:\n    c: 2\n")
+}
+
+func (s *S) TestEncoderRegisterType(c *C) {
+	type secret string
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.RegisterType("!Deployment", deployment{})
+	enc.RegisterType("!CronJob", cronJob{})
+	enc.RegisterType("!secret", secret(""))
+	v := []workload{
+		deployment{Name: "web", Count: 3},
+		&cronJob{Name: "backup", Schedule: "@daily"},
+	}
+	c.Assert(enc.Encode(map[string]interface{}{"jobs": v, "token": secret("x")}), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, `jobs:
+- !Deployment
+  name: web
+  count: 3
+- !CronJob
+  name: backup
+  schedule: '@daily'
+token: !secret x
+`)
+
+	var out struct{ Jobs []workload }
+	dec := yaml.NewDecoder(&buf)
+	dec.RegisterType("!Deployment", deployment{})
+	dec.RegisterType("!CronJob", cronJob{})
+	dec.RegisterType("!secret", secret(""))
+	c.Assert(dec.Decode(&out), IsNil)
+	c.Assert(out.Jobs, DeepEquals, v)
+}
+
+func (s *S) TestMarshalAll(c *C) {
+	var m map[string]int
+	out, err := yaml.MarshalAll([]interface{}{map[string]int{"a": 1}, nil, m, "x"})
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "a: 1\n--- null\n--- {}\n--- x\n")
+
+	out, err = yaml.MarshalAll(nil)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "")
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	c.Assert(enc.EncodeAll(nil, 1), IsNil)
+	c.Assert(enc.EncodeAll([]int{2}), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "null\n--- 1\n---\n- 2\n")
+}
+
+func (s *S) TestEncoderMixedKeys(c *C) {
+	type P struct{ X, Y int }
+	want := "false: 1\n1.5: 2\n? - 1\n  - 2\n: 3\n? - 2\n  - 1\n: 4\na: 5\n? x: 1\n  \"y\": 2\n: 6\n? x: 2\n  \"y\": 1\n: 7\n"
+	for i := 0; i < 20; i++ {
+		m := map[interface{}]int{false: 1, 1.5: 2, [2]int{1, 2}: 3, [2]int{2, 1}: 4, "a": 5, P{1, 2}: 6, P{2, 1}: 7}
+		data, err := yaml.Marshal(m)
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, want)
+	}
+
+	for _, v := range []interface{}{
+		map[interface{}]int{"a": 1, P{1, 2}: 2},
+		map[[1]int]int{{1}: 1},
+		map[complex128]int{1: 1},
+	} {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetScalarKeys(true)
+		c.Assert(enc.Encode(v), ErrorMatches, "yaml: cannot marshal map key of type .* as a scalar")
+	}
+}
+
+func (s *S) TestEncoderDirectives(c *C) {
+	type foo struct{ A int }
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetVersionDirective(1, 2)
+	enc.RegisterTagHandle("!e!", "tag:example.com,2000:")
+	enc.RegisterType("tag:example.com,2000:foo", foo{})
+	c.Assert(enc.Encode(map[string]interface{}{"x": foo{1}}), IsNil)
+	c.Assert(enc.Encode(1), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, `%YAML 1.2
+%TAG !e! tag:example.com,2000:
+---
+x: !e!foo
+  a: 1
+...
+%YAML 1.2
+%TAG !e! tag:example.com,2000:
+--- 1
+`)
+
+	enc = yaml.NewEncoder(&buf)
+	enc.RegisterTagHandle("e", "tag:example.com,2000:")
+	c.Assert(enc.Encode(1), ErrorMatches, "yaml: tag handle must start with '!'")
+	c.Assert(func() { enc.SetVersionDirective(2, 0) }, PanicMatches, "yaml: unsupported YAML version 2.0")
+}
+
+func (s *S) TestEncoderExplicitTags(c *C) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetExplicitTags(true)
+	v := yaml.MapSlice{{"a", 1}, {"b", []interface{}{1.5, nil, "x"}}, {"c", map[string]bool{"d": true}}}
+	c.Assert(enc.Encode(v), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, `!!map
+!!str a: !!int 1
+!!str b: !!seq
+- !!float 1.5
+- !!null null
+- !!str x
+!!str c: !!map
+  !!str d: !!bool true
+`)
+}
+
+func (s *S) TestEncoderFinalNewline(c *C) {
+	for _, t := range []struct {
+		markers yaml.DocumentMarkers
+		newline bool
+		want    string
+	}{
+		{yaml.MarkBetween, true, "a: 1\n--- x\n"},
+		{yaml.MarkBetween, false, "a: 1\n--- x"},
+		{yaml.MarkEnd, true, "a: 1\n...\n--- x\n...\n"},
+		{yaml.MarkEnd, false, "a: 1\n...\n--- x\n..."},
+		{yaml.MarkNone, false, "a: 1\nx"},
+	} {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetDocumentMarkers(t.markers)
+		enc.SetFinalNewline(t.newline)
+		c.Assert(enc.Encode(map[string]int{"a": 1}), IsNil)
+		c.Assert(enc.Encode("x"), IsNil)
+		c.Assert(enc.Close(), IsNil)
+		c.Assert(buf.String(), Equals, t.want)
+	}
+}
+
+func (s *S) TestEncoderFlowWrap(c *C) {
+	type T struct {
+		A []string `yaml:"a,flow"`
+		B []int    `yaml:"b,flow"`
+	}
+	v := T{A: []string{"a long item", "one that runs past the width", "end"}, B: []int{1, 2}}
+	for _, t := range []struct {
+		wrap yaml.FlowWrap
+		want string
+	}{
+		{yaml.FlowFold, "a: [a long item, one that runs past\n    the width, end]\nb: [1, 2]\n"},
+		{yaml.FlowWrapItems, "a: [a long item, one that runs past the width,\n  end]\nb: [1, 2]\n"},
+		{yaml.FlowOneLine, "a: [a long item, one that runs past the width, end]\nb: [1, 2]\n"},
+		{yaml.FlowToBlock, "a:\n- a long item\n- one that runs past the width\n- end\nb: [1, 2]\n"},
+	} {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetLineWidth(30)
+		enc.SetFlowWrap(t.wrap)
+		c.Assert(enc.Encode(v), IsNil)
+		c.Assert(enc.Close(), IsNil)
+		c.Assert(buf.String(), Equals, t.want)
+	}
+}
+
+func (s *S) TestEncoderSectionComments(c *C) {
+	type server struct {
+		Host string
+		Port int
+	}
+	type config struct {
+		Name    string
+		Server  server `yaml:"server,comment=Where to listen."`
+		Workers int
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetSectionComments(func(key interface{}) string {
+		if key == "name" {
+			return ""
+		}
+		return "== " + key.(string) + " =="
+	})
+	v := config{"x", server{"h", 1}, 2}
+	c.Assert(enc.Encode(v), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, `name: x
+
+# == server ==
+# Where to listen.
+server:
+  host: h
+  port: 1
+
+# == workers ==
+workers: 2
+`)
+
+	var back config
+	c.Assert(yaml.Unmarshal(buf.Bytes(), &back), IsNil)
+	c.Assert(back, DeepEquals, v)
+}
+
+func (s *S) TestEncoderSkeleton(c *C) {
+	type tls struct {
+		Cert string `yaml:"cert,omitempty,comment=Path to the certificate."`
+	}
+	type node struct {
+		Name string
+		Next *node `yaml:",omitempty"`
+	}
+	type config struct {
+		Host string   `yaml:"host,default=localhost"`
+		Port int      `yaml:"port,omitempty,default=8080,comment=Port to listen on."`
+		TLS  *tls     `yaml:"tls,omitempty"`
+		Tags []string `yaml:"tags,omitempty"`
+		Node *node
+		Hops []string `yaml:"hops,default=[local]"`
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetSkeleton(true)
+	c.Assert(enc.Encode(config{Host: "example.com"}), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, `host: example.com
+# Port to listen on.
+port: 8080
+tls:
+  # Path to the certificate.
+  cert: ""
+tags: []
+node:
+  name: ""
+  next: null
+hops:
+- local
+`)
+}
+
 type errorWriter struct{}
 
 func (errorWriter) Write([]byte) (int, error) {
@@ -477,13 +1295,13 @@ var marshalErrorTests = []struct {
 		B       int
 		inlineB ",inline"
 	}{1, inlineB{2, inlineC{3}}},
-	panic: `Duplicated key 'b' in struct struct \{ B int; .*`,
+	error: `Duplicated key 'b' in struct struct \{ B int; .*`,
 }, {
 	value: &struct {
 		A int
 		B map[string]int ",inline"
 	}{1, map[string]int{"a": 2}},
-	panic: `Can't have key "a" in inlined map; conflicts with struct field`,
+	error: `Can't have key "a" in inlined map; conflicts with struct field`,
 }}
 
 func (s *S) TestMarshalErrors(c *C) {
@@ -0,0 +1,136 @@
+package yaml
+
+import (
+	"io"
+)
+
+// EventType identifies the kind of an Event.
+type EventType int
+
+// Event types, in the order of yaml_event_type_t.
+const (
+	StreamStartEvent EventType = iota + 1
+	StreamEndEvent
+	DocumentStartEvent
+	DocumentEndEvent
+	AliasEvent
+	ScalarEvent
+	SequenceStartEvent
+	SequenceEndEvent
+	MappingStartEvent
+	MappingEndEvent
+)
+
+func (t EventType) String() string {
+	// Event types have the same values as the parser's.
+	return yaml_event_type_t(t).String()
+}
+
+// Style is the presentation style of a scalar or a collection in the
+// input.
+type Style int
+
+const (
+	// Scalar styles.
+	PlainStyle Style = iota + 1
+	SingleQuotedStyle
+	DoubleQuotedStyle
+	LiteralStyle
+	FoldedStyle
+
+	// Sequence and mapping styles.
+	BlockStyle
+	FlowStyle
+)
+
+var scalarStyles = map[yaml_scalar_style_t]Style{
+	yaml_PLAIN_SCALAR_STYLE:         PlainStyle,
+	yaml_SINGLE_QUOTED_SCALAR_STYLE: SingleQuotedStyle,
+	yaml_DOUBLE_QUOTED_SCALAR_STYLE: DoubleQuotedStyle,
+	yaml_LITERAL_SCALAR_STYLE:       LiteralStyle,
+	yaml_FOLDED_SCALAR_STYLE:        FoldedStyle,
+}
+
+// An Event is a step of the parsing of a YAML stream, as produced by
+// a Parser.
+type Event struct {
+	Type EventType
+
+	// Start and End hold the positions where the event starts and
+	// ends in the input.
+	Start, End Position
+
+	// Anchor holds the anchor of a scalar or collection, or the
+	// anchor named by an alias.
+	Anchor string
+
+	// Tag holds the explicit tag of a scalar or collection, in its
+	// short form for the standard tags, such as !!str.
+	Tag string
+
+	// Value holds the value of a scalar.
+	Value string
+
+	// Implicit reports whether the document start or end marker is
+	// absent, or whether a scalar or collection has no explicit tag.
+	Implicit bool
+
+	// Style holds the style of a scalar or collection.
+	Style Style
+}
+
+// A Parser reads the events of a YAML stream, without building the
+// Go values that Decoder produces. It's useful for tools such as
+// linters and converters that need the structure and positions of
+// the input, including the style of scalars.
+type Parser struct {
+	parser *parser
+	done   bool
+}
+
+// NewParser returns a new parser that reads from r.
+func NewParser(r io.Reader) *Parser {
+	return &Parser{parser: newParserFromReader(r)}
+}
+
+// Next returns the next event in the stream. It returns io.EOF after
+// the StreamEndEvent.
+func (p *Parser) Next() (ev Event, err error) {
+	if p.done {
+		return Event{}, io.EOF
+	}
+	defer handleErr(&err)
+	pp := p.parser
+	if pp.event.typ == yaml_NO_EVENT {
+		pp.next()
+	}
+	e := &pp.event
+	ev = Event{
+		Type:     EventType(e.typ),
+		Start:    Position{Line: e.start_mark.line + 1, Column: e.start_mark.column + 1},
+		End:      Position{Line: e.end_mark.line + 1, Column: e.end_mark.column + 1},
+		Anchor:   string(e.anchor),
+		Tag:      shortTag(string(e.tag)),
+		Value:    string(e.value),
+		Implicit: e.implicit,
+	}
+	switch e.typ {
+	case yaml_SCALAR_EVENT:
+		ev.Style = scalarStyles[e.scalar_style()]
+	case yaml_SEQUENCE_START_EVENT:
+		ev.Style = BlockStyle
+		if e.sequence_style() == yaml_FLOW_SEQUENCE_STYLE {
+			ev.Style = FlowStyle
+		}
+	case yaml_MAPPING_START_EVENT:
+		ev.Style = BlockStyle
+		if e.mapping_style() == yaml_FLOW_MAPPING_STYLE {
+			ev.Style = FlowStyle
+		}
+	case yaml_STREAM_END_EVENT:
+		p.done = true
+	}
+	yaml_event_delete(e)
+	e.typ = yaml_NO_EVENT
+	return ev, nil
+}
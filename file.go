@@ -0,0 +1,19 @@
+//go:build go1.16
+// +build go1.16
+
+package yaml
+
+import "io/fs"
+
+// UnmarshalFile reads the file with the given name from fsys and
+// decodes it into out as Unmarshal does. Error messages name the file,
+// reporting positions as "name:12: " rather than "line 12: ".
+func UnmarshalFile(fsys fs.FS, name string, out interface{}) error {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	opts := defaultDecodeOptions
+	opts.filename = name
+	return unmarshal(data, out, opts)
+}
@@ -0,0 +1,32 @@
+//go:build go1.16
+// +build go1.16
+
+package yaml_test
+
+import (
+	"testing/fstest"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
+)
+
+func (s *S) TestUnmarshalFile(c *C) {
+	fsys := fstest.MapFS{
+		"config.yaml": {Data: []byte("a: 1\nb: x\n")},
+		"broken.yaml": {Data: []byte("a: [1\n")},
+		"long.yaml":   {Data: []byte("a: abcdefghijklmnopqrstuvwxyz\n")},
+	}
+	var v struct{ A, B int }
+	err := yaml.UnmarshalFile(fsys, "config.yaml", &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  config.yaml:2: cannot unmarshal !!str `x` into int")
+	c.Assert(v.A, Equals, 1)
+
+	err = yaml.UnmarshalFile(fsys, "broken.yaml", &v)
+	c.Assert(err, ErrorMatches, "yaml: broken.yaml:1: did not find expected .*")
+
+	err = yaml.UnmarshalFile(fsys, "long.yaml", &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  long.yaml:1: cannot unmarshal !!str `abcdefg...` into int")
+
+	err = yaml.UnmarshalFile(fsys, "missing.yaml", &v)
+	c.Assert(err, ErrorMatches, "open missing.yaml: file does not exist")
+}
@@ -0,0 +1,20 @@
+//go:build go1.18
+// +build go1.18
+
+package yaml
+
+// UnmarshalT is like Unmarshal, but returns the decoded value of type T
+// rather than storing it into a value given by the caller.
+func UnmarshalT[T any](in []byte) (T, error) {
+	var v T
+	err := Unmarshal(in, &v)
+	return v, err
+}
+
+// DecodeT is like dec.Decode, but returns the decoded value of type T.
+// Go does not allow methods to have type parameters, hence a function.
+func DecodeT[T any](dec *Decoder) (T, error) {
+	var v T
+	err := dec.Decode(&v)
+	return v, err
+}
@@ -0,0 +1,34 @@
+//go:build go1.18
+// +build go1.18
+
+package yaml_test
+
+import (
+	"io"
+	"strings"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
+)
+
+func (s *S) TestUnmarshalT(c *C) {
+	type T struct{ A int }
+	v, err := yaml.UnmarshalT[T]([]byte("a: 1\n"))
+	c.Assert(err, IsNil)
+	c.Assert(v, Equals, T{1})
+
+	m, err := yaml.UnmarshalT[map[string][]int]([]byte("a: [1, x]\n"))
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `x` into int")
+	c.Assert(m, DeepEquals, map[string][]int{"a": {1}})
+}
+
+func (s *S) TestDecodeT(c *C) {
+	dec := yaml.NewDecoder(strings.NewReader("1\n---\n2\n"))
+	for _, want := range []int{1, 2} {
+		v, err := yaml.DecodeT[int](dec)
+		c.Assert(err, IsNil)
+		c.Assert(v, Equals, want)
+	}
+	_, err := yaml.DecodeT[int](dec)
+	c.Assert(err, Equals, io.EOF)
+}
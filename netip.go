@@ -0,0 +1,15 @@
+//go:build go1.18
+// +build go1.18
+
+package yaml
+
+import (
+	"net/netip"
+	"reflect"
+)
+
+func init() {
+	addressTypes[reflect.TypeOf(netip.Addr{})] = true
+	addressTypes[reflect.TypeOf(netip.AddrPort{})] = true
+	addressTypes[reflect.TypeOf(netip.Prefix{})] = true
+}
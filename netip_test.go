@@ -0,0 +1,29 @@
+//go:build go1.18
+// +build go1.18
+
+package yaml_test
+
+import (
+	"net/netip"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
+)
+
+func (s *S) TestUnmarshalNetip(c *C) {
+	var v struct {
+		Addr   netip.Addr
+		Prefix netip.Prefix
+	}
+	err := yaml.Unmarshal([]byte("addr: ::1\nprefix: 192.168.0.0/24\n"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v.Addr, Equals, netip.MustParseAddr("::1"))
+	c.Assert(v.Prefix, Equals, netip.MustParsePrefix("192.168.0.0/24"))
+
+	data, err := yaml.Marshal(&v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "addr: ::1\nprefix: 192.168.0.0/24\n")
+
+	err = yaml.Unmarshal([]byte("addr: 1.2.3\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: invalid address `1.2.3` for netip.Addr")
+}
@@ -0,0 +1,197 @@
+package yaml
+
+import "io"
+
+// A DecoderOption configures a Decoder created by NewDecoderWithOptions.
+// Each option has the same effect as the Decoder method it is named after.
+type DecoderOption func(*Decoder)
+
+// NewDecoderWithOptions returns a new decoder that reads from r,
+// configured with the provided options in order.
+func NewDecoderWithOptions(r io.Reader, opts ...DecoderOption) *Decoder {
+	dec := NewDecoder(r)
+	for _, opt := range opts {
+		opt(dec)
+	}
+	return dec
+}
+
+// WithStrict enables or disables strict decoding (see Decoder.SetStrict).
+func WithStrict(strict bool) DecoderOption {
+	return func(dec *Decoder) { dec.SetStrict(strict) }
+}
+
+// WithUnknownFieldWarnings reports unknown fields as warnings
+// (see Decoder.SetUnknownFieldWarnings).
+func WithUnknownFieldWarnings(enabled bool) DecoderOption {
+	return func(dec *Decoder) { dec.SetUnknownFieldWarnings(enabled) }
+}
+
+// WithMaxDepth limits the nesting depth of the input (see Decoder.SetMaxDepth).
+func WithMaxDepth(depth int) DecoderOption {
+	return func(dec *Decoder) { dec.SetMaxDepth(depth) }
+}
+
+// WithMaxDocuments limits the number of documents read
+// (see Decoder.SetMaxDocuments).
+func WithMaxDocuments(n int) DecoderOption {
+	return func(dec *Decoder) { dec.SetMaxDocuments(n) }
+}
+
+// WithMaxNodes limits the number of nodes decoded per document
+// (see Decoder.SetMaxNodes).
+func WithMaxNodes(n int) DecoderOption {
+	return func(dec *Decoder) { dec.SetMaxNodes(n) }
+}
+
+// WithValueTruncation sets how values are abbreviated in error messages
+// (see Decoder.SetValueTruncation).
+func WithValueTruncation(limit int, ellipsis string) DecoderOption {
+	return func(dec *Decoder) { dec.SetValueTruncation(limit, ellipsis) }
+}
+
+// WithSourceLines sets whether error messages quote the source line
+// (see Decoder.SetSourceLines).
+func WithSourceLines(enabled bool) DecoderOption {
+	return func(dec *Decoder) { dec.SetSourceLines(enabled) }
+}
+
+// WithTabWidth expands tabs in indentation (see Decoder.SetTabWidth).
+func WithTabWidth(width int) DecoderOption {
+	return func(dec *Decoder) { dec.SetTabWidth(width) }
+}
+
+// WithPositionOffset offsets reported positions (see Decoder.SetPositionOffset).
+func WithPositionOffset(line, column int) DecoderOption {
+	return func(dec *Decoder) { dec.SetPositionOffset(line, column) }
+}
+
+// WithFilename names the input in error messages (see Decoder.SetFilename).
+func WithFilename(name string) DecoderOption {
+	return func(dec *Decoder) { dec.SetFilename(name) }
+}
+
+// WithJSONTags uses json tags for fields without yaml tags
+// (see Decoder.SetJSONTags).
+func WithJSONTags(enabled bool) DecoderOption {
+	return func(dec *Decoder) { dec.SetJSONTags(enabled) }
+}
+
+// WithInlineEmbedded inlines anonymous struct fields by default
+// (see Decoder.SetInlineEmbedded).
+func WithInlineEmbedded(enabled bool) DecoderOption {
+	return func(dec *Decoder) { dec.SetInlineEmbedded(enabled) }
+}
+
+// WithExactNumbers rejects lossy numeric conversions
+// (see Decoder.SetExactNumbers).
+func WithExactNumbers(enabled bool) DecoderOption {
+	return func(dec *Decoder) { dec.SetExactNumbers(enabled) }
+}
+
+// WithFieldCase sets how keys are matched to struct fields (see Decoder.SetFieldCase).
+func WithFieldCase(c FieldCase) DecoderOption {
+	return func(dec *Decoder) { dec.SetFieldCase(c) }
+}
+
+// WithDuplicateKeyPolicy sets how duplicate keys are handled
+// (see Decoder.SetDuplicateKeyPolicy).
+func WithDuplicateKeyPolicy(p DuplicateKeyPolicy) DecoderOption {
+	return func(dec *Decoder) { dec.SetDuplicateKeyPolicy(p) }
+}
+
+// WithStrictScalars restricts implicit scalar typing (see Decoder.SetStrictScalars).
+func WithStrictScalars(enabled bool) DecoderOption {
+	return func(dec *Decoder) { dec.SetStrictScalars(enabled) }
+}
+
+// WithSchema sets the rules used to resolve untagged scalars
+// (see Decoder.SetSchema).
+func WithSchema(schema Schema) DecoderOption {
+	return func(dec *Decoder) { dec.SetSchema(schema) }
+}
+
+// WithoutMergeKeys treats << as an ordinary key (see Decoder.DisableMergeKeys).
+func WithoutMergeKeys() DecoderOption {
+	return func(dec *Decoder) { dec.DisableMergeKeys() }
+}
+
+// WithoutAnchors rejects anchors and aliases (see Decoder.DisallowAnchors).
+func WithoutAnchors() DecoderOption {
+	return func(dec *Decoder) { dec.DisallowAnchors() }
+}
+
+// WithMergeMode sets how merge keys are applied (see Decoder.SetMergeMode).
+func WithMergeMode(m MergeMode) DecoderOption {
+	return func(dec *Decoder) { dec.SetMergeMode(m) }
+}
+
+// WithNumber stores numbers in interface{} values as a Number
+// (see Decoder.UseNumber).
+func WithNumber() DecoderOption {
+	return func(dec *Decoder) { dec.UseNumber() }
+}
+
+// WithInt64 stores integers in interface{} values as an int64, a
+// uint64 or a *big.Int (see Decoder.UseInt64).
+func WithInt64() DecoderOption {
+	return func(dec *Decoder) { dec.UseInt64() }
+}
+
+// WithTimeLayouts sets extra layouts for time.Time values
+// (see Decoder.SetTimeLayouts).
+func WithTimeLayouts(layouts ...string) DecoderOption {
+	return func(dec *Decoder) { dec.SetTimeLayouts(layouts...) }
+}
+
+// WithDecodeHook sets conversion hooks (see Decoder.SetDecodeHook).
+func WithDecodeHook(hooks ...DecodeHook) DecoderOption {
+	return func(dec *Decoder) { dec.SetDecodeHook(hooks...) }
+}
+
+// WithValidator sets a validation function for decoded structs
+// (see Decoder.SetValidator).
+func WithValidator(validate func(v interface{}) error) DecoderOption {
+	return func(dec *Decoder) { dec.SetValidator(validate) }
+}
+
+// WithIncludeResolver enables the !include tag
+// (see Decoder.SetIncludeResolver).
+func WithIncludeResolver(r IncludeResolver) DecoderOption {
+	return func(dec *Decoder) { dec.SetIncludeResolver(r) }
+}
+
+// WithExpandEnv expands variable references in scalars
+// (see Decoder.SetExpandEnv).
+func WithExpandEnv(lookup func(name string) (string, bool)) DecoderOption {
+	return func(dec *Decoder) { dec.SetExpandEnv(lookup) }
+}
+
+// WithNullPolicy sets how null values are decoded (see Decoder.SetNullPolicy).
+func WithNullPolicy(p NullPolicy) DecoderOption {
+	return func(dec *Decoder) { dec.SetNullPolicy(p) }
+}
+
+// WithNullValues sets the values null is decoded as
+// (see Decoder.SetNullValues).
+func WithNullValues(values ...interface{}) DecoderOption {
+	return func(dec *Decoder) { dec.SetNullValues(values...) }
+}
+
+// WithResetTargets zeroes values before decoding into them
+// (see Decoder.ResetTargets).
+func WithResetTargets(enabled bool) DecoderOption {
+	return func(dec *Decoder) { dec.ResetTargets(enabled) }
+}
+
+// WithBOMPolicy sets whether a byte order mark may start the input
+// (see Decoder.SetBOMPolicy).
+func WithBOMPolicy(p BOMPolicy) DecoderOption {
+	return func(dec *Decoder) { dec.SetBOMPolicy(p) }
+}
+
+// WithBytesFormat sets how strings are read into byte slices
+// (see Decoder.SetBytesFormat).
+func WithBytesFormat(f BytesFormat) DecoderOption {
+	return func(dec *Decoder) { dec.SetBytesFormat(f) }
+}
@@ -2,6 +2,7 @@ package yaml
 
 import (
 	"io"
+	"strings"
 )
 
 // Set the reader error and return 0.
@@ -10,6 +11,7 @@ func yaml_parser_set_reader_error(parser *yaml_parser_t, problem string, offset
 	parser.problem = problem
 	parser.problem_offset = offset
 	parser.problem_value = value
+	parser.problem_mark = parser.reader_mark
 	return false
 }
 
@@ -18,37 +20,51 @@ const (
 	bom_UTF8    = "\xef\xbb\xbf"
 	bom_UTF16LE = "\xff\xfe"
 	bom_UTF16BE = "\xfe\xff"
+	bom_UTF32LE = "\xff\xfe\x00\x00"
+	bom_UTF32BE = "\x00\x00\xfe\xff"
 )
 
 // Determine the input stream encoding by checking the BOM symbol. If no BOM is
-// found, the UTF-8 encoding is assumed. Return 1 on success, 0 on failure.
+// found, the encoding is deduced from the pattern of null bytes that starts
+// the stream, as described in the YAML spec, or the UTF-8 encoding is assumed.
+// Return 1 on success, 0 on failure.
 func yaml_parser_determine_encoding(parser *yaml_parser_t) bool {
 	// Ensure that we had enough bytes in the raw buffer.
-	for !parser.eof && len(parser.raw_buffer)-parser.raw_buffer_pos < 3 {
+	for !parser.eof && len(parser.raw_buffer)-parser.raw_buffer_pos < 4 {
 		if !yaml_parser_update_raw_buffer(parser) {
 			return false
 		}
 	}
 
 	// Determine the encoding.
-	buf := parser.raw_buffer
-	pos := parser.raw_buffer_pos
-	avail := len(buf) - pos
-	if avail >= 2 && buf[pos] == bom_UTF16LE[0] && buf[pos+1] == bom_UTF16LE[1] {
-		parser.encoding = yaml_UTF16LE_ENCODING
-		parser.raw_buffer_pos += 2
-		parser.offset += 2
-	} else if avail >= 2 && buf[pos] == bom_UTF16BE[0] && buf[pos+1] == bom_UTF16BE[1] {
+	buf := parser.raw_buffer[parser.raw_buffer_pos:]
+	bom := 0
+	switch {
+	case strings.HasPrefix(string(buf), bom_UTF32LE):
+		parser.encoding, bom = yaml_UTF32LE_ENCODING, 4
+	case strings.HasPrefix(string(buf), bom_UTF32BE):
+		parser.encoding, bom = yaml_UTF32BE_ENCODING, 4
+	case strings.HasPrefix(string(buf), bom_UTF16LE):
+		parser.encoding, bom = yaml_UTF16LE_ENCODING, 2
+	case strings.HasPrefix(string(buf), bom_UTF16BE):
+		parser.encoding, bom = yaml_UTF16BE_ENCODING, 2
+	case strings.HasPrefix(string(buf), bom_UTF8):
+		parser.encoding, bom = yaml_UTF8_ENCODING, 3
+	case len(buf) >= 4 && buf[0] == 0 && buf[1] == 0 && buf[2] == 0:
+		parser.encoding = yaml_UTF32BE_ENCODING
+	case len(buf) >= 4 && buf[1] == 0 && buf[2] == 0 && buf[3] == 0:
+		parser.encoding = yaml_UTF32LE_ENCODING
+	case len(buf) >= 2 && buf[0] == 0:
 		parser.encoding = yaml_UTF16BE_ENCODING
-		parser.raw_buffer_pos += 2
-		parser.offset += 2
-	} else if avail >= 3 && buf[pos] == bom_UTF8[0] && buf[pos+1] == bom_UTF8[1] && buf[pos+2] == bom_UTF8[2] {
-		parser.encoding = yaml_UTF8_ENCODING
-		parser.raw_buffer_pos += 3
-		parser.offset += 3
-	} else {
+	case len(buf) >= 2 && buf[1] == 0:
+		parser.encoding = yaml_UTF16LE_ENCODING
+	default:
 		parser.encoding = yaml_UTF8_ENCODING
 	}
+	parser.bom = bom > 0
+	parser.raw_buffer_pos += bom
+	parser.offset += bom
+	parser.mark.offset += bom
 	return true
 }
 
@@ -79,7 +95,10 @@ func yaml_parser_update_raw_buffer(parser *yaml_parser_t) bool {
 	if err == io.EOF {
 		parser.eof = true
 	} else if err != nil {
-		return yaml_parser_set_reader_error(parser, "input error: "+err.Error(), parser.offset, -1)
+		yaml_parser_set_reader_error(parser, "input error: "+err.Error(), parser.offset, -1)
+		// Input errors have no position in the input.
+		parser.problem_mark.line = -1
+		return false
 	}
 	return true
 }
@@ -335,6 +354,33 @@ func yaml_parser_update_buffer(parser *yaml_parser_t, length int) bool {
 					width = 2
 				}
 
+			case yaml_UTF32LE_ENCODING, yaml_UTF32BE_ENCODING:
+				// Check for incomplete UTF-32 character.
+				if raw_unread < 4 {
+					if parser.eof {
+						return yaml_parser_set_reader_error(parser,
+							"incomplete UTF-32 character",
+							parser.offset, -1)
+					}
+					break inner
+				}
+
+				// Get the character.
+				b := parser.raw_buffer[parser.raw_buffer_pos : parser.raw_buffer_pos+4]
+				if parser.encoding == yaml_UTF32LE_ENCODING {
+					value = rune(b[0]) | rune(b[1])<<8 | rune(b[2])<<16 | rune(b[3])<<24
+				} else {
+					value = rune(b[3]) | rune(b[2])<<8 | rune(b[1])<<16 | rune(b[0])<<24
+				}
+				width = 4
+
+				// Check the range of the value.
+				if value >= 0xD800 && value <= 0xDFFF || value > 0x10FFFF || value < 0 {
+					return yaml_parser_set_reader_error(parser,
+						"invalid Unicode character",
+						parser.offset, int(value))
+				}
+
 			default:
 				panic("impossible")
 			}
@@ -362,6 +408,15 @@ func yaml_parser_update_buffer(parser *yaml_parser_t, length int) bool {
 			parser.raw_buffer_pos += width
 			parser.offset += width
 
+			// Track the position of the reader for its errors.
+			parser.reader_mark.index++
+			if value == '\n' {
+				parser.reader_mark.line++
+				parser.reader_mark.column = 0
+			} else {
+				parser.reader_mark.column++
+			}
+
 			// Finally put the character into the buffer.
 			if value <= 0x7F {
 				// 0000 0000-0000 007F . 0xxxxxxx
@@ -2,7 +2,9 @@ package yaml
 
 import (
 	"encoding/base64"
+	"fmt"
 	"math"
+	"math/big"
 	"regexp"
 	"strconv"
 	"strings"
@@ -196,6 +198,114 @@ func resolve(tag string, in string) (rtag string, out interface{}) {
 	return yaml_STR_TAG, in
 }
 
+var coreInt = regexp.MustCompile(`^(?:[-+]?[0-9]+|0o[0-7]+|0x[0-9a-fA-F]+)$`)
+
+// resolveCore is like resolve, but follows the YAML 1.2 core schema
+// for untagged scalars: booleans are only true or false, integers are
+// decimal, 0o octal or 0x hexadecimal without underscores, and floats
+// have no underscores. Timestamps are still recognized.
+func resolveCore(tag string, in string) (rtag string, out interface{}) {
+	rtag, out = resolve(tag, in)
+	if tag != "" {
+		return rtag, out
+	}
+	switch rtag {
+	case yaml_BOOL_TAG:
+		if !isCoreBool(in) {
+			return yaml_STR_TAG, in
+		}
+	case yaml_INT_TAG, yaml_FLOAT_TAG:
+		if _, ok := resolveMap[in]; ok {
+			// .inf, .nan and friends.
+			return rtag, out
+		}
+		if coreInt.MatchString(in) {
+			if isLegacyOctal(in) {
+				return resolveDecimal(in)
+			}
+			return rtag, out
+		}
+		if !yamlStyleFloat.MatchString(in) {
+			return yaml_STR_TAG, in
+		}
+		if rtag == yaml_INT_TAG {
+			// Parsed as an integer only thanks to YAML 1.1 syntax.
+			return yaml_STR_TAG, in
+		}
+	}
+	return rtag, out
+}
+
+// resolveDecimal resolves in, a decimal integer that may have leading
+// zeros, using the same types as resolve.
+func resolveDecimal(in string) (rtag string, out interface{}) {
+	if intv, err := strconv.ParseInt(in, 10, 64); err == nil {
+		if intv == int64(int(intv)) {
+			return yaml_INT_TAG, int(intv)
+		}
+		return yaml_INT_TAG, intv
+	}
+	if uintv, err := strconv.ParseUint(strings.TrimPrefix(in, "+"), 10, 64); err == nil {
+		return yaml_INT_TAG, uintv
+	}
+	floatv, _ := strconv.ParseFloat(in, 64)
+	return yaml_FLOAT_TAG, floatv
+}
+
+var bigIntegerYAML11 = regexp.MustCompile(`^[-+]?(?:0b[01]+|0x[0-9a-fA-F]+|0o[0-7]+|0[0-7]*|[1-9][0-9]*)$`)
+
+// bigInteger returns the integer written in s following the rules of
+// schema, or nil if s is not an integer. Unlike resolve, it accepts
+// integers of any size.
+func bigInteger(s string, schema Schema) *big.Int {
+	base := 0
+	if schema == SchemaCore {
+		if !coreInt.MatchString(s) {
+			return nil
+		}
+		if isLegacyOctal(s) {
+			base = 10
+		}
+	} else {
+		s = strings.Replace(s, "_", "", -1)
+		if !bigIntegerYAML11.MatchString(s) {
+			return nil
+		}
+	}
+	b, ok := new(big.Int).SetString(strings.TrimPrefix(s, "+"), base)
+	if !ok {
+		return nil
+	}
+	return b
+}
+
+// isCoreBool returns whether s is one of the boolean spellings
+// of the YAML 1.2 core schema.
+func isCoreBool(s string) bool {
+	switch s {
+	case "true", "True", "TRUE", "false", "False", "FALSE":
+		return true
+	}
+	return false
+}
+
+// isLegacyOctal returns whether s is an integer written with a leading
+// zero, which YAML 1.1 reads as octal.
+func isLegacyOctal(s string) bool {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	if len(s) < 2 || s[0] != '0' {
+		return false
+	}
+	for _, c := range s[1:] {
+		if (c < '0' || c > '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
 // encodeBase64 encodes s as base64 that is broken up into multiple lines
 // as appropriate for the resulting length.
 func encodeBase64(s string) string {
@@ -256,3 +366,42 @@ func parseTimestamp(s string) (time.Time, bool) {
 	}
 	return time.Time{}, false
 }
+
+// expandEnv replaces the ${VAR} and ${VAR:-default} references in s
+// with the values that lookup provides for them. A default is used when
+// the variable is unset or empty. $${ stands for a literal ${.
+func expandEnv(s string, lookup func(string) (string, bool)) (string, error) {
+	var buf strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			buf.WriteString(s)
+			return buf.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			buf.WriteString(s[:i-1])
+			buf.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		buf.WriteString(s[:i])
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference in %q", s[i:])
+		}
+		ref := s[i+2 : i+end]
+		s = s[i+end+1:]
+		name, def, hasDef := ref, "", false
+		if j := strings.Index(ref, ":-"); j >= 0 {
+			name, def, hasDef = ref[:j], ref[j+2:], true
+		}
+		value, ok := lookup(name)
+		switch {
+		case hasDef && value == "":
+			value = def
+		case !ok:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		buf.WriteString(value)
+	}
+}
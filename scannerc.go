@@ -487,12 +487,37 @@ func cache(parser *yaml_parser_t, length int) bool {
 	return parser.unread >= length || yaml_parser_update_buffer(parser, length)
 }
 
+// Skip a tab in the indentation of a line, which reaches the next
+// multiple of tab_width columns.
+func skip_indent_tab(parser *yaml_parser_t) {
+	column := parser.mark.column
+	skip(parser)
+	parser.mark.column = column + parser.tab_width - column%parser.tab_width
+}
+
 // Advance the buffer pointer.
 func skip(parser *yaml_parser_t) {
+	w := width(parser.buffer[parser.buffer_pos])
 	parser.mark.index++
 	parser.mark.column++
+	parser.mark.offset += input_width(parser, w)
 	parser.unread--
-	parser.buffer_pos += width(parser.buffer[parser.buffer_pos])
+	parser.buffer_pos += w
+}
+
+// Return the number of bytes taken in the input by a character that
+// takes w bytes in the buffer, which holds UTF-8.
+func input_width(parser *yaml_parser_t, w int) int {
+	switch parser.encoding {
+	case yaml_UTF16LE_ENCODING, yaml_UTF16BE_ENCODING:
+		if w == 4 {
+			return 4
+		}
+		return 2
+	case yaml_UTF32LE_ENCODING, yaml_UTF32BE_ENCODING:
+		return 4
+	}
+	return w
 }
 
 func skip_line(parser *yaml_parser_t) {
@@ -500,14 +525,17 @@ func skip_line(parser *yaml_parser_t) {
 		parser.mark.index += 2
 		parser.mark.column = 0
 		parser.mark.line++
+		parser.mark.offset += 2 * input_width(parser, 1)
 		parser.unread -= 2
 		parser.buffer_pos += 2
 	} else if is_break(parser.buffer, parser.buffer_pos) {
+		w := width(parser.buffer[parser.buffer_pos])
 		parser.mark.index++
 		parser.mark.column = 0
 		parser.mark.line++
+		parser.mark.offset += input_width(parser, w)
 		parser.unread--
-		parser.buffer_pos += width(parser.buffer[parser.buffer_pos])
+		parser.buffer_pos += w
 	}
 }
 
@@ -530,6 +558,7 @@ func read(parser *yaml_parser_t, s []byte) []byte {
 	}
 	parser.mark.index++
 	parser.mark.column++
+	parser.mark.offset += input_width(parser, w)
 	parser.unread--
 	return s
 }
@@ -544,6 +573,8 @@ func read_line(parser *yaml_parser_t, s []byte) []byte {
 		s = append(s, '\n')
 		parser.buffer_pos += 2
 		parser.mark.index++
+		parser.mark.offset += input_width(parser, 1)
+		pos++
 		parser.unread--
 	case buf[pos] == '\r' || buf[pos] == '\n':
 		// CR|LF . LF
@@ -560,6 +591,7 @@ func read_line(parser *yaml_parser_t, s []byte) []byte {
 	default:
 		return s
 	}
+	parser.mark.offset += input_width(parser, parser.buffer_pos-pos)
 	parser.mark.index++
 	parser.mark.column = 0
 	parser.mark.line++
@@ -1461,8 +1493,17 @@ func yaml_parser_scan_to_next_token(parser *yaml_parser_t) bool {
 			return false
 		}
 
-		for parser.buffer[parser.buffer_pos] == ' ' || ((parser.flow_level > 0 || !parser.simple_key_allowed) && parser.buffer[parser.buffer_pos] == '\t') {
-			skip(parser)
+		// [Go] Tabs at the beginning of the line are indentation too
+		// when a tab width is set.
+		line_start := parser.mark.column == 0
+		for {
+			if line_start && parser.tab_width > 0 && parser.buffer[parser.buffer_pos] == '\t' {
+				skip_indent_tab(parser)
+			} else if parser.buffer[parser.buffer_pos] == ' ' || ((parser.flow_level > 0 || !parser.simple_key_allowed) && parser.buffer[parser.buffer_pos] == '\t') {
+				skip(parser)
+			} else {
+				break
+			}
 			if parser.unread < 1 && !yaml_parser_update_buffer(parser, 1) {
 				return false
 			}
@@ -2267,8 +2308,17 @@ func yaml_parser_scan_block_scalar_breaks(parser *yaml_parser_t, indent *int, br
 		if parser.unread < 1 && !yaml_parser_update_buffer(parser, 1) {
 			return false
 		}
-		for (*indent == 0 || parser.mark.column < *indent) && is_space(parser.buffer, parser.buffer_pos) {
-			skip(parser)
+		// [Go] With a tab width, the tabs that fit in the indentation
+		// are part of it, and the others part of the content.
+		for *indent == 0 || parser.mark.column < *indent {
+			if is_space(parser.buffer, parser.buffer_pos) {
+				skip(parser)
+			} else if is_tab(parser.buffer, parser.buffer_pos) && parser.tab_width > 0 &&
+				(*indent == 0 || parser.mark.column+parser.tab_width-parser.mark.column%parser.tab_width <= *indent) {
+				skip_indent_tab(parser)
+			} else {
+				break
+			}
 			if parser.unread < 1 && !yaml_parser_update_buffer(parser, 1) {
 				return false
 			}
@@ -2657,6 +2707,13 @@ func yaml_parser_scan_plain_scalar(parser *yaml_parser_t, token *yaml_token_t) b
 			if is_blank(parser.buffer, parser.buffer_pos) {
 
 				// Check for tab characters that abuse indentation.
+				if leading_blanks && parser.tab_width > 0 && is_tab(parser.buffer, parser.buffer_pos) {
+					skip_indent_tab(parser)
+					if parser.unread < 1 && !yaml_parser_update_buffer(parser, 1) {
+						return false
+					}
+					continue
+				}
 				if leading_blanks && parser.mark.column < indent && is_tab(parser.buffer, parser.buffer_pos) {
 					yaml_parser_set_scanner_error(parser, "while scanning a plain scalar",
 						start_mark, "found a tab character that violates indentation")
@@ -1,7 +1,9 @@
 package yaml
 
 import (
+	"math"
 	"reflect"
+	"time"
 	"unicode"
 )
 
@@ -25,7 +27,11 @@ func (l keyList) Less(i, j int) bool {
 	af, aok := keyFloat(a)
 	bf, bok := keyFloat(b)
 	if aok && bok {
-		if af != bf {
+		if an, bn := math.IsNaN(af), math.IsNaN(bf); an || bn {
+			if an != bn {
+				return an
+			}
+		} else if af != bf {
 			return af < bf
 		}
 		if ak != bk {
@@ -34,7 +40,10 @@ func (l keyList) Less(i, j int) bool {
 		return numLess(a, b)
 	}
 	if ak != reflect.String || bk != reflect.String {
-		return ak < bk
+		if ak != bk {
+			return ak < bk
+		}
+		return sameKindLess(a, b)
 	}
 	ar, br := []rune(a.String()), []rune(b.String())
 	for i := 0; i < len(ar) && i < len(br); i++ {
@@ -77,6 +86,64 @@ func (l keyList) Less(i, j int) bool {
 	return len(ar) < len(br)
 }
 
+// sameKindLess returns whether a < b for keys of the same kind that
+// are neither numbers nor strings. Arrays and structs are compared
+// element by element, so that their order doesn't depend on the order
+// of the map.
+func sameKindLess(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Array:
+		for i := 0; i < a.Len() && i < b.Len(); i++ {
+			l := keyList{a.Index(i), b.Index(i)}
+			if l.Less(0, 1) {
+				return true
+			}
+			if l.Less(1, 0) {
+				return false
+			}
+		}
+		return a.Len() < b.Len()
+	case reflect.Struct:
+		if a.Type() != b.Type() {
+			return a.Type().String() < b.Type().String()
+		}
+		if a.Type() == timeType && a.CanInterface() && b.CanInterface() {
+			return a.Interface().(time.Time).Before(b.Interface().(time.Time))
+		}
+		for i := 0; i < a.NumField(); i++ {
+			l := keyList{a.Field(i), b.Field(i)}
+			if l.Less(0, 1) {
+				return true
+			}
+			if l.Less(1, 0) {
+				return false
+			}
+		}
+	case reflect.Complex64, reflect.Complex128:
+		ac, bc := a.Complex(), b.Complex()
+		if real(ac) != real(bc) {
+			return real(ac) < real(bc)
+		}
+		return imag(ac) < imag(bc)
+	}
+	return false
+}
+
+// lexicalLess returns whether a < b, comparing strings byte by byte
+// and other keys as keyList does.
+func lexicalLess(a, b reflect.Value) bool {
+	for (a.Kind() == reflect.Interface || a.Kind() == reflect.Ptr) && !a.IsNil() {
+		a = a.Elem()
+	}
+	for (b.Kind() == reflect.Interface || b.Kind() == reflect.Ptr) && !b.IsNil() {
+		b = b.Elem()
+	}
+	if a.Kind() == reflect.String && b.Kind() == reflect.String {
+		return a.String() < b.String()
+	}
+	return keyList{a, b}.Less(0, 1)
+}
+
 // keyFloat returns a float value for v if it is a number/bool
 // and whether it is a number/bool or not.
 func keyFloat(v reflect.Value) (f float64, ok bool) {
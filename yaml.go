@@ -7,6 +7,8 @@
 package yaml
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -24,6 +26,69 @@ type MapItem struct {
 	Key, Value interface{}
 }
 
+// Set holds the members of a YAML !!set, a mapping whose keys have no
+// values. A !!set is decoded into an interface{} value as a Set, and
+// into a map as its keys with zero values, or true for maps of bools.
+// A Set is marshaled as a !!set.
+type Set map[interface{}]struct{}
+
+// Omap holds the items of a YAML !!omap, a sequence of mappings with a
+// single key each that describes an ordered mapping. A !!omap is
+// decoded into an interface{} value as an Omap, and into a map, a
+// struct or a MapSlice as the mapping it describes. An Omap is
+// marshaled as a !!omap.
+type Omap []MapItem
+
+// Pairs holds the items of a YAML !!pairs, which is like a !!omap but
+// may have duplicate keys. It's decoded and marshaled as Omap is.
+type Pairs []MapItem
+
+// Number holds the text of a YAML integer or float, as stored into
+// interface{} values by a Decoder after UseNumber is called. Keeping
+// the original text preserves the precision of values that do not fit
+// an int64 or a float64. A Number is marshaled as the number it holds.
+type Number string
+
+// String returns the text of the number.
+func (n Number) String() string {
+	return string(n)
+}
+
+// Int64 returns the number as an int64. It fails if the number is not
+// an integer or does not fit an int64.
+func (n Number) Int64() (int64, error) {
+	switch v := n.resolve().(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	}
+	return 0, fmt.Errorf("yaml: cannot convert number %q to int64", string(n))
+}
+
+// Float64 returns the number as a float64.
+func (n Number) Float64() (float64, error) {
+	switch v := n.resolve().(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	}
+	return 0, fmt.Errorf("yaml: cannot convert number %q to float64", string(n))
+}
+
+func (n Number) resolve() interface{} {
+	tag, v := resolve("", string(n))
+	if tag != yaml_INT_TAG && tag != yaml_FLOAT_TAG {
+		return nil
+	}
+	return v
+}
+
 // The Unmarshaler interface may be implemented by types to customize their
 // behavior when being unmarshaled from a YAML document. The UnmarshalYAML
 // method receives a function that may be called to unmarshal the original
@@ -33,6 +98,23 @@ type Unmarshaler interface {
 	UnmarshalYAML(unmarshal func(interface{}) error) error
 }
 
+// The ContextUnmarshaler interface is like Unmarshaler, but its method
+// also receives the context given to Decoder.DecodeContext, or
+// context.Background when decoding without one. It is used in
+// preference to Unmarshaler when a type implements both.
+type ContextUnmarshaler interface {
+	UnmarshalYAMLContext(ctx context.Context, unmarshal func(interface{}) error) error
+}
+
+// The Validator interface may be implemented by types to check their
+// value once it has been unmarshaled from a YAML document. An error
+// returned by ValidateYAML is reported as a TypeError entry with the
+// line of the value, and does not stop decoding. ValidateYAML is not
+// called for values unmarshaled by a custom Unmarshaler.
+type Validator interface {
+	ValidateYAML() error
+}
+
 // The Marshaler interface may be implemented by types to customize their
 // behavior when being marshaled into a YAML document. The returned value
 // is marshaled in place of the original value implementing Marshaler.
@@ -78,7 +160,7 @@ type Marshaler interface {
 // supported tag options.
 //
 func Unmarshal(in []byte, out interface{}) (err error) {
-	return unmarshal(in, out, false)
+	return unmarshal(in, out, defaultDecodeOptions)
 }
 
 // UnmarshalStrict is like Unmarshal except that any fields that are found
@@ -86,21 +168,297 @@ func Unmarshal(in []byte, out interface{}) (err error) {
 // keys that are duplicates, will result in
 // an error.
 func UnmarshalStrict(in []byte, out interface{}) (err error) {
-	return unmarshal(in, out, true)
+	opts := defaultDecodeOptions
+	opts.strict = true
+	return unmarshal(in, out, opts)
+}
+
+// UnmarshalAll decodes every document in the input into a new element
+// appended to the slice pointed to by out (see Decoder.DecodeAll).
+func UnmarshalAll(in []byte, out interface{}) (err error) {
+	return NewDecoder(bytes.NewReader(in)).DecodeAll(out)
+}
+
+// UnmarshalFrontMatter decodes the front matter at the start of in, as
+// found in Markdown documents, into out, and returns the content that
+// follows it. The front matter is delimited by lines holding only ---,
+// and may also be terminated by a line holding only "...". Line numbers
+// in errors refer to lines of in.
+//
+// If in does not start with a --- line, it is returned unchanged and
+// out is left untouched.
+func UnmarshalFrontMatter(in []byte, out interface{}) (rest []byte, err error) {
+	body, ok := frontMatterLine(in)
+	if !ok {
+		return in, nil
+	}
+	for data := body; len(data) > 0; {
+		line := data
+		next := data[len(data):]
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, next = data[:i], data[i+1:]
+		}
+		if text := string(bytes.TrimRight(line, " \t\r")); text == "---" || text == "..." {
+			content := body[:len(body)-len(data)]
+			dec := NewDecoder(bytes.NewReader(content))
+			dec.SetPositionOffset(1, 0)
+			if err := dec.Decode(out); err != nil && err != io.EOF {
+				return nil, err
+			}
+			return next, nil
+		}
+		data = next
+	}
+	return nil, errors.New("yaml: front matter is not terminated")
+}
+
+// frontMatterLine reports whether in starts with a --- line, and returns
+// what follows that line.
+func frontMatterLine(in []byte) (rest []byte, ok bool) {
+	in = bytes.TrimPrefix(in, []byte("\xef\xbb\xbf"))
+	if !bytes.HasPrefix(in, []byte("---")) {
+		return nil, false
+	}
+	line := in
+	if i := bytes.IndexByte(in, '\n'); i >= 0 {
+		line, rest = in[:i], in[i+1:]
+	}
+	if string(bytes.TrimRight(line, " \t\r")) != "---" {
+		return nil, false
+	}
+	return rest, true
 }
 
 // A Decoder reads and decodes YAML values from an input stream.
 type Decoder struct {
+	opts     decodeOptions
+	parser   *parser
+	warnings []string
+	anchors  map[string]Position
+
+	// err holds an error found by More, returned by the next Decode.
+	err error
+}
+
+// decodeOptions holds the settings that affect how documents
+// are decoded, shared by Unmarshal and Decoder.
+type decodeOptions struct {
 	strict bool
-	parser *parser
+
+	// valueLimit and ellipsis control how long scalar values are
+	// abbreviated when quoted in error messages.
+	valueLimit int
+	ellipsis   string
+
+	// lineOffset and columnOffset are added to the positions
+	// reported for the decoded document.
+	lineOffset   int
+	columnOffset int
+
+	// filename names the input in error messages, if set.
+	filename string
+
+	fieldCase     FieldCase
+	duplicateKeys DuplicateKeyPolicy
+	strictScalars bool
+	schema        Schema
+	noMerge       bool
+	mergeMode     MergeMode
+	useNumber     bool
+	useInt64      bool
+	timeLayouts   []string
+	decodeHooks   []DecodeHook
+	validator     func(v interface{}) error
+	tags          map[string]TagConstructor
+	types         map[string]reflect.Type
+	unions        map[reflect.Type]*union
+	includes      IncludeResolver
+	lookupEnv     func(name string) (string, bool)
+	nulls         NullPolicy
+	nullValues    map[reflect.Type]reflect.Value
+	resetTargets  bool
+	jsonTags      bool
+	embedInline   bool
+	maxNodes      int
+	exact         bool
+	warnUnknown   bool
+	bytes         BytesFormat
 }
 
+// DuplicateKeyPolicy controls how keys that appear more than once in
+// the same mapping are handled.
+type DuplicateKeyPolicy int
+
+const (
+	// DuplicateKeyDefault reports duplicate keys as type errors in
+	// strict mode, and otherwise silently lets the last value win.
+	DuplicateKeyDefault DuplicateKeyPolicy = iota
+
+	// DuplicateKeyError reports duplicate keys as type errors.
+	DuplicateKeyError
+
+	// DuplicateKeyFirstWins keeps the first value of a duplicate key,
+	// and reports a warning with the lines of both occurrences.
+	DuplicateKeyFirstWins
+
+	// DuplicateKeyLastWins keeps the last value of a duplicate key,
+	// and reports a warning with the lines of both occurrences.
+	DuplicateKeyLastWins
+)
+
+// NullPolicy controls how null values are decoded into targets that
+// are neither pointers nor interfaces. Pointers and interfaces are
+// always set to nil, even if they held a value before.
+type NullPolicy int
+
+const (
+	// NullZero sets the target to its zero value. This is the default.
+	NullZero NullPolicy = iota
+
+	// NullError reports null values as type errors, leaving the
+	// target unchanged.
+	NullError
+
+	// NullSentinel sets the target to the value provided for its
+	// type with SetNullValues, or to its zero value if there is none.
+	NullSentinel
+)
+
+// BOMPolicy controls whether a byte order mark may start the input.
+// The encoding of the input, which is UTF-8, UTF-16 or UTF-32, is
+// deduced from the byte order mark or from the null bytes that start
+// the input. Input that is invalid in its encoding is always rejected
+// with an error that reports the line of the problem.
+type BOMPolicy int
+
+const (
+	// BOMAllow accepts input with or without a byte order mark.
+	// This is the default.
+	BOMAllow BOMPolicy = iota
+
+	// BOMRequire rejects input without a byte order mark.
+	BOMRequire
+
+	// BOMForbid rejects input with a byte order mark.
+	BOMForbid
+)
+
+// FieldCase controls how mapping keys are matched against the keys
+// of struct fields.
+type FieldCase int
+
+const (
+	// FieldCaseExact matches mapping keys to field keys exactly.
+	// This is the default.
+	FieldCaseExact FieldCase = iota
+
+	// FieldCaseStrict matches mapping keys to field keys exactly, and
+	// reports a type error for any key that would only match a field
+	// if case were ignored.
+	FieldCaseStrict
+
+	// FieldCaseFold matches mapping keys to field keys ignoring case,
+	// and reports a warning for any key whose case differs from the
+	// key of the field it matched. Keys that match several fields when
+	// ignoring case are only matched exactly.
+	FieldCaseFold
+)
+
+// MergeMode controls how the mappings named by a merge key (<<) are
+// combined with the mapping holding the key.
+type MergeMode int
+
+const (
+	// MergeShallow inserts the keys of the merged mappings that are
+	// not already present, as defined by the YAML merge key type.
+	// This is the default.
+	MergeShallow MergeMode = iota
+
+	// MergeDeep is like MergeShallow, but when both sides hold a
+	// mapping for the same key, the mappings are merged recursively.
+	// A warning is reported when a merged value is overridden by a
+	// value of a different kind, such as a mapping by a scalar.
+	MergeDeep
+
+	// MergeDeepConcat is like MergeDeep, and additionally concatenates
+	// the sequences found on both sides for the same key, with the
+	// merged items first.
+	MergeDeepConcat
+)
+
+// A DecodeHook converts YAML values into values of type to, for types
+// that cannot or should not implement Unmarshaler themselves. The hook
+// may call unmarshal to decode the YAML value into any Go value, and
+// reports through ok whether it provided the value v. The value must
+// be assignable or convertible to type to. Errors are handled as the
+// errors returned by UnmarshalYAML.
+//
+// Hooks are called for every non-null value decoded, including for the
+// values given to unmarshal, so a hook must not call unmarshal with a
+// value of the type it handles.
+type DecodeHook func(to reflect.Type, unmarshal func(interface{}) error) (v interface{}, ok bool, err error)
+
+// A TagConstructor builds the Go value of a YAML value with an
+// application-specific tag, such as !env or !secret. It may call
+// unmarshal to decode the tagged value into any Go value, such as a
+// string for a scalar. The value it returns is stored into the decoded value if
+// it's assignable or convertible to its type. Errors it returns are
+// reported with the line of the tagged value.
+type TagConstructor func(unmarshal func(interface{}) error) (interface{}, error)
+
+// An IncludeResolver provides the documents named by !include tags
+// (see Decoder.SetIncludeResolver).
+type IncludeResolver interface {
+	ResolveInclude(name string) ([]byte, error)
+}
+
+// IncludeResolverFunc adapts a function into an IncludeResolver.
+type IncludeResolverFunc func(name string) ([]byte, error)
+
+// ResolveInclude returns f(name).
+func (f IncludeResolverFunc) ResolveInclude(name string) ([]byte, error) {
+	return f(name)
+}
+
+// Schema selects the rules used to resolve the type of untagged
+// plain scalars.
+type Schema int
+
+const (
+	// SchemaYAML11 resolves scalars following YAML 1.1, so that for
+	// example yes and off are booleans and 0755 is an octal integer.
+	// This is the default.
+	SchemaYAML11 Schema = iota
+
+	// SchemaCore resolves scalars following the YAML 1.2 core schema:
+	// only true and false are booleans, integers are decimal, 0o
+	// octal or 0x hexadecimal, and neither underscores nor sexagesimal
+	// notation are accepted in numbers. Timestamps are still resolved
+	// as in YAML 1.1.
+	SchemaCore
+)
+
+var defaultDecodeOptions = decodeOptions{
+	valueLimit: 10,
+	ellipsis:   "...",
+}
+
+// Position is a position in a YAML document, as stored into a struct
+// field with the ,pos flag. Lines and columns start at 1, and include
+// the offsets set with Decoder.SetPositionOffset.
+type Position struct {
+	Line, Column int
+}
+
+var positionType = reflect.TypeOf(Position{})
+
 // NewDecoder returns a new decoder that reads from r.
 //
 // The decoder introduces its own buffering and may read
 // data from r beyond the YAML values requested.
 func NewDecoder(r io.Reader) *Decoder {
 	return &Decoder{
+		opts:   defaultDecodeOptions,
 		parser: newParserFromReader(r),
 	}
 }
@@ -108,7 +466,401 @@ func NewDecoder(r io.Reader) *Decoder {
 // SetStrict sets whether strict decoding behaviour is enabled when
 // decoding items in the data (see UnmarshalStrict). By default, decoding is not strict.
 func (dec *Decoder) SetStrict(strict bool) {
-	dec.strict = strict
+	dec.opts.strict = strict
+}
+
+// SetUnknownFieldWarnings sets whether mapping keys that match no
+// field of the struct being decoded are reported as warnings, which
+// Warnings returns, rather than silently ignored. Strict decoding
+// reports them as errors instead.
+func (dec *Decoder) SetUnknownFieldWarnings(enabled bool) {
+	dec.opts.warnUnknown = enabled
+}
+
+// SetValueTruncation sets how scalar values are abbreviated when they
+// are quoted in error messages. Values longer than limit bytes are cut
+// short and suffixed with ellipsis so that the result is limit bytes
+// long. A limit of zero or less disables truncation.
+//
+// By default values are truncated to 10 bytes using "..." as the ellipsis.
+func (dec *Decoder) SetValueTruncation(limit int, ellipsis string) {
+	dec.opts.valueLimit = limit
+	dec.opts.ellipsis = ellipsis
+}
+
+// SetSourceLines sets whether the decoder retains the input it reads,
+// so that error messages can quote the source line they refer to.
+// It must be called before the first call to Decode.
+func (dec *Decoder) SetSourceLines(enabled bool) {
+	dec.parser.retainSource(enabled)
+}
+
+// SetTabWidth makes the decoder accept tabs in indentation, which YAML
+// forbids, by reading the tabs that start each line as reaching the
+// next multiple of width columns. In block scalars, only the tabs that
+// fit within the indentation of the scalar are read this way, and the
+// tabs that follow are kept in the content. A width of zero or less, the
+// default, leaves tabs alone, and errors caused by them then tell the
+// column of the tab to replace. It must be called before the first
+// call to Decode.
+func (dec *Decoder) SetTabWidth(width int) {
+	if width > 0 {
+		dec.parser.expandTabs(width)
+	}
+}
+
+// SetPositionOffset sets offsets that are added to every line and
+// column number reported by the decoder. It is useful when the YAML
+// input is a fragment embedded in a larger file, such as a template or
+// a Markdown front matter block, and positions should be reported
+// relative to that file. Error messages mostly label their lines only,
+// as in "line 12: " or, with SetFilename, "name:12: ", so the column
+// offset shows in Position values and in the columns some messages
+// mention.
+func (dec *Decoder) SetPositionOffset(line, column int) {
+	dec.opts.lineOffset = line
+	dec.opts.columnOffset = column
+	dec.parser.lineOffset = line
+	dec.parser.columnOffset = column
+}
+
+// SetFilename sets the name of the input, which error messages then
+// report positions in as "name:12: " rather than "line 12: ".
+func (dec *Decoder) SetFilename(name string) {
+	dec.opts.filename = name
+	dec.parser.filename = name
+}
+
+// SetMaxDepth sets the maximum nesting depth of mappings and sequences
+// accepted in the input. Deeper documents fail to decode. A depth of
+// zero, the default, means there is no limit.
+func (dec *Decoder) SetMaxDepth(depth int) {
+	dec.parser.maxDepth = depth
+}
+
+// SetMaxDocuments sets the maximum number of documents the decoder
+// reads from its input. Decoding the document after the last one
+// allowed fails. A limit of zero, the default, means there is no limit.
+func (dec *Decoder) SetMaxDocuments(n int) {
+	dec.parser.maxDocuments = n
+}
+
+// SetJSONTags sets whether the json tags of struct fields are used as
+// their yaml tags when they have none, so that types shared with JSON
+// need no duplicate tags. Only the key and the omitempty option of json
+// tags are honored.
+func (dec *Decoder) SetJSONTags(enabled bool) {
+	dec.opts.jsonTags = enabled
+}
+
+// SetInlineEmbedded sets whether anonymous struct fields without a key
+// in their tag are inlined as if they had the inline flag. As with
+// encoding/json, the fields of the struct and of shallower embedded
+// structs hide the conflicting fields of deeper ones, and conflicting
+// fields at the same depth are ignored. Embedded pointers to structs
+// are not inlined.
+func (dec *Decoder) SetInlineEmbedded(enabled bool) {
+	dec.opts.embedInline = enabled
+}
+
+// SetMaxNodes sets the maximum number of nodes decoded from a single
+// document, counting the nodes of anchored values again each time they
+// are referenced by an alias. Decoding stops with an error once the
+// limit is exceeded. A limit of zero, the default, means there is no
+// limit.
+func (dec *Decoder) SetMaxNodes(n int) {
+	dec.opts.maxNodes = n
+}
+
+// SetExactNumbers sets whether numbers that would lose information
+// when decoded into a numeric value, such as 3.7 into an int or
+// 16777217 into a float32, are reported as type errors rather than
+// truncated or rounded. Fields with the exact tag flag are decoded this
+// way whatever the setting.
+func (dec *Decoder) SetExactNumbers(enabled bool) {
+	dec.opts.exact = enabled
+}
+
+// BytesFormat selects how byte slices are written as YAML, and how
+// strings are read into byte slices. Whatever the format, values tagged
+// !!binary are read as base64 data and sequences of integers as the
+// bytes they hold. Untagged strings are only read in the format itself,
+// as "cafe" is valid hex, base64 and text alike, so a decoder must be
+// given the format of the encoder that wrote them.
+type BytesFormat int
+
+const (
+	// BytesSequence writes byte slices as sequences of integers. It
+	// reports untagged strings read into byte slices as type errors.
+	// This is the default.
+	BytesSequence BytesFormat = iota
+
+	// BytesBase64 writes byte slices as base64 data tagged !!binary,
+	// and reads untagged strings as base64 data too.
+	BytesBase64
+
+	// BytesHex writes byte slices as strings of hexadecimal digits,
+	// and reads strings the same way.
+	BytesHex
+
+	// BytesString writes byte slices as strings when they hold valid
+	// UTF-8, and as BytesBase64 does otherwise. It reads strings into
+	// byte slices as their bytes.
+	BytesString
+)
+
+// bytesFormats maps the values of the bytes tag flag to formats.
+var bytesFormats = map[string]BytesFormat{
+	"base64": BytesBase64,
+	"hex":    BytesHex,
+	"string": BytesString,
+}
+
+// SetBytesFormat sets how strings are read into byte slices, unless
+// their struct field has the bytes flag. Whatever the format, values
+// tagged !!binary are read as base64 data and sequences of integers
+// are read as the bytes they hold, but untagged strings are only read
+// in the given format (see BytesFormat). Strings written by an encoder
+// with BytesHex or BytesString are type errors with the default format.
+// BytesBase64 tags its strings !!binary, so they are always read back.
+func (dec *Decoder) SetBytesFormat(f BytesFormat) {
+	dec.opts.bytes = f
+}
+
+// SetFieldCase sets how mapping keys are matched against the keys of
+// struct fields. By default, keys are matched exactly.
+func (dec *Decoder) SetFieldCase(c FieldCase) {
+	dec.opts.fieldCase = c
+}
+
+// SetDuplicateKeyPolicy sets how keys that appear more than once in the
+// same mapping are handled. The policy applies whether or not decoding
+// is strict, except that DuplicateKeyDefault follows the strict setting.
+func (dec *Decoder) SetDuplicateKeyPolicy(p DuplicateKeyPolicy) {
+	dec.opts.duplicateKeys = p
+}
+
+// SetStrictScalars sets whether implicit scalar typing is restricted
+// to its least surprising forms. When enabled, only true and false
+// (in lower, title or upper case) are booleans, integers written
+// with a leading zero are strings rather than octal numbers, and
+// floating point values such as 1.0 are never converted into
+// integer types. Explicitly tagged values are not affected.
+func (dec *Decoder) SetStrictScalars(enabled bool) {
+	dec.opts.strictScalars = enabled
+}
+
+// SetSchema sets the rules used to resolve the type of untagged plain
+// scalars. By default, YAML 1.1 rules are used.
+func (dec *Decoder) SetSchema(schema Schema) {
+	dec.opts.schema = schema
+}
+
+// DisableMergeKeys makes the decoder treat << as an ordinary mapping
+// key rather than a merge key, so that it can be decoded into a map
+// entry or a struct field with the "<<" key.
+func (dec *Decoder) DisableMergeKeys() {
+	dec.opts.noMerge = true
+}
+
+// DisallowAnchors makes the decoder reject documents that define
+// anchors or use aliases, which is a simple way of ruling out the
+// amplification of untrusted input through aliases. The error names the
+// line of the first anchor or alias found.
+func (dec *Decoder) DisallowAnchors() {
+	dec.parser.noAnchors = true
+}
+
+// SetMergeMode sets how the mappings named by merge keys are combined
+// with the mapping holding the key. By default, merges are shallow.
+func (dec *Decoder) SetMergeMode(m MergeMode) {
+	dec.opts.mergeMode = m
+}
+
+// UseNumber makes the decoder store integers and floats decoded into
+// interface{} values as a Number rather than as an int or float64.
+func (dec *Decoder) UseNumber() {
+	dec.opts.useNumber = true
+}
+
+// UseInt64 makes the decoder store integers decoded into interface{}
+// values as an int64 rather than an int, whatever the platform.
+// Integers that do not fit an int64 are stored as a uint64 if they fit
+// one, and otherwise as a *big.Int rather than as a float64 or string.
+// UseNumber takes precedence over UseInt64.
+func (dec *Decoder) UseInt64() {
+	dec.opts.useInt64 = true
+}
+
+// SetTimeLayouts sets layouts, as understood by time.Parse, that are
+// tried in order when a value that is not a YAML timestamp is decoded
+// into a time.Time. Fields with a format tag flag use that layout
+// instead.
+func (dec *Decoder) SetTimeLayouts(layouts ...string) {
+	dec.opts.timeLayouts = layouts
+}
+
+// SetDecodeHook sets hooks that are called in order before decoding
+// each value, until one of them provides the value. Hooks take
+// precedence over the Unmarshaler and encoding.TextUnmarshaler
+// implementations of the decoded types.
+func (dec *Decoder) SetDecodeHook(hooks ...DecodeHook) {
+	dec.opts.decodeHooks = hooks
+}
+
+// SetValidator sets a function called with every struct value decoded,
+// after any ValidateYAML method, as a pointer when possible. Errors it
+// returns are reported as for Validator.
+func (dec *Decoder) SetValidator(validate func(v interface{}) error) {
+	dec.opts.validator = validate
+}
+
+// RegisterTag registers fn as the constructor of the values that have
+// the given tag, such as "!env". Standard tags may be given in their
+// short form, such as "!!str".
+func (dec *Decoder) RegisterTag(tag string, fn TagConstructor) {
+	tags := make(map[string]TagConstructor, len(dec.opts.tags)+1)
+	for t, f := range dec.opts.tags {
+		tags[t] = f
+	}
+	tags[longTag(tag)] = fn
+	dec.opts.tags = tags
+}
+
+// RegisterType registers the type of v as the type of the values that
+// have the given tag, such as "!Deployment", when they are decoded into
+// an interface value. The value is then decoded into a new value of
+// that type, or a pointer to it if only the pointer implements the
+// interface. Once a type is registered, decoding a value with any other
+// tag into an interface value fails with an error listing the registered
+// tags, except for the standard tags, the non-specific "!" tag, and the
+// tags handled by RegisterTag or SetIncludeResolver.
+func (dec *Decoder) RegisterType(tag string, v interface{}) {
+	types := make(map[string]reflect.Type, len(dec.opts.types)+1)
+	for t, typ := range dec.opts.types {
+		types[t] = typ
+	}
+	types[longTag(tag)] = reflect.TypeOf(v)
+	dec.opts.types = types
+}
+
+// RegisterUnion registers the types of the values that are decoded
+// into interface values of the type pointed to by iface, such as
+// (*Shape)(nil), depending on the value of the discriminator key of
+// their mappings, such as "kind" or "type". Each value is decoded into
+// a new value of the type of kinds[kind], or a pointer to it if only
+// the pointer implements the interface. The discriminator key is
+// decoded like any other key, so the types should have a field for it
+// when decoding is strict. A missing or unknown discriminator value is
+// reported as an error listing the valid ones.
+func (dec *Decoder) RegisterUnion(iface interface{}, key string, kinds map[string]interface{}) {
+	t := reflect.TypeOf(iface)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Interface {
+		panic("yaml: RegisterUnion needs a pointer to an interface type, not " + fmt.Sprintf("%T", iface))
+	}
+	u := &union{key: key, types: make(map[string]reflect.Type, len(kinds))}
+	for kind, v := range kinds {
+		u.types[kind] = reflect.TypeOf(v)
+	}
+	unions := make(map[reflect.Type]*union, len(dec.opts.unions)+1)
+	for t, u := range dec.opts.unions {
+		unions[t] = u
+	}
+	unions[t.Elem()] = u
+	dec.opts.unions = unions
+}
+
+// SetIncludeResolver enables the !include tag. A scalar with that tag,
+// such as "!include db.yaml", is decoded as the single document that r
+// provides for its value, with the same settings and limits. The nodes
+// of included documents count against the limits of SetMaxNodes and of
+// aliasing, as if they were part of the including document. Included
+// documents may include others, but not themselves. Type errors and warnings
+// found in included documents are reported at the include site, for
+// example as "line 3: in db.yaml: line 1: ...".
+func (dec *Decoder) SetIncludeResolver(r IncludeResolver) {
+	dec.opts.includes = r
+}
+
+// SetExpandEnv enables the expansion of ${VAR} and ${VAR:-default}
+// references in scalar values, using lookup to obtain the value of
+// variables, before the type of the values is resolved. Pass
+// os.LookupEnv to use the environment of the process. A default is
+// used if the variable is unset or empty, and $${ is replaced by ${.
+// A reference to an unset variable without a default is reported as a
+// type error. A nil lookup disables expansion, which is the default.
+func (dec *Decoder) SetExpandEnv(lookup func(name string) (string, bool)) {
+	dec.opts.lookupEnv = lookup
+}
+
+// SetNullPolicy sets how null values are decoded into targets that
+// are neither pointers nor interfaces. By default they are set to
+// their zero value.
+func (dec *Decoder) SetNullPolicy(p NullPolicy) {
+	dec.opts.nulls = p
+}
+
+// SetNullValues provides the values that null values are decoded as
+// under NullSentinel, one for each type of target, and sets the policy
+// to NullSentinel. For example, SetNullValues(-1) decodes null into int
+// targets as -1. The values cannot be nil, as their types select the
+// targets.
+func (dec *Decoder) SetNullValues(values ...interface{}) {
+	nullValues := make(map[reflect.Type]reflect.Value, len(values))
+	for _, v := range values {
+		if v == nil {
+			panic("yaml: SetNullValues needs typed values, not nil")
+		}
+		rv := reflect.ValueOf(v)
+		nullValues[rv.Type()] = rv
+	}
+	dec.opts.nulls = NullSentinel
+	dec.opts.nullValues = nullValues
+}
+
+// SetBOMPolicy sets whether a byte order mark may start the input.
+// By default it's optional.
+func (dec *Decoder) SetBOMPolicy(p BOMPolicy) {
+	dec.parser.bom = p
+}
+
+// ResetTargets sets whether the value pointed to by the argument of
+// Decode is set to its zero value before decoding into it. By default
+// decoding merges into the existing value: fields and map keys absent
+// from the document keep their previous values.
+func (dec *Decoder) ResetTargets(enabled bool) {
+	dec.opts.resetTargets = enabled
+}
+
+// Warnings returns the warnings reported by the most recent call to
+// Decode. Warnings describe suspicious input that was nonetheless
+// decoded, and are formatted like the entries of TypeError.
+func (dec *Decoder) Warnings() []string {
+	return dec.warnings
+}
+
+// Anchors returns the anchors defined by the document read by the most
+// recent call to Decode, with the position where each of them is
+// defined. If an anchor is defined more than once, the last definition
+// is reported.
+func (dec *Decoder) Anchors() map[string]Position {
+	return dec.anchors
+}
+
+// InputOffset returns the offset in bytes, from the start of the input,
+// of the end of the input read so far. After a call to Decode, it's the
+// offset of the end of the decoded document. It's useful to record
+// progress through a large stream.
+func (dec *Decoder) InputOffset() int64 {
+	return int64(dec.parser.end.offset)
+}
+
+// Position returns the position of the end of the input read so far, as
+// InputOffset does, in lines and columns. Positions are offset as set
+// by SetPositionOffset.
+func (dec *Decoder) Position() Position {
+	m := dec.parser.end
+	return Position{Line: m.line + 1 + dec.opts.lineOffset, Column: m.column + 1 + dec.opts.columnOffset}
 }
 
 // Decode reads the next YAML-encoded value from its input
@@ -117,15 +869,59 @@ func (dec *Decoder) SetStrict(strict bool) {
 // See the documentation for Unmarshal for details about the
 // conversion of YAML into a Go value.
 func (dec *Decoder) Decode(v interface{}) (err error) {
-	d := newDecoder(dec.strict)
+	return dec.DecodeContext(context.Background(), v)
+}
+
+// DecodeContext is like Decode, but aborts reading and decoding the
+// value with ctx.Err() as soon as ctx is done. The decoder should not
+// be used further after that happens.
+func (dec *Decoder) DecodeContext(ctx context.Context, v interface{}) (err error) {
+	return dec.decode(ctx, "", reflect.ValueOf(v))
+}
+
+// DecodePath reads the next YAML document from its input like Decode,
+// but stores only the value at path into the value pointed to by v,
+// without decoding the rest of the document. The path is made of
+// mapping keys and sequence indexes separated by dots, such as
+// "spec.containers.0.image". Keys brought in by merge keys are found
+// too. DecodePath fails if there is no value at path.
+func (dec *Decoder) DecodePath(path string, v interface{}) (err error) {
+	return dec.decode(context.Background(), path, reflect.ValueOf(v))
+}
+
+func (dec *Decoder) decode(ctx context.Context, path string, out reflect.Value) (err error) {
+	if dec.err != nil {
+		err, dec.err = dec.err, nil
+		return err
+	}
+	d := newDecoder(dec.opts)
+	d.source = dec.parser.source
+	d.parser = dec.parser
+	defer func() { dec.warnings = d.warnings }()
+	d.unmarshalCtx = ctx
+	if ctx.Done() != nil {
+		d.ctx = ctx
+		dec.parser.ctx = ctx
+		defer func() { dec.parser.ctx = nil }()
+	}
 	defer handleErr(&err)
+	dec.anchors = nil
 	node := dec.parser.parse()
 	if node == nil {
 		return io.EOF
 	}
-	out := reflect.ValueOf(v)
+	dec.anchors = make(map[string]Position, len(node.anchors))
+	for name, n := range node.anchors {
+		dec.anchors[name] = d.position(n)
+	}
+	if path != "" {
+		node = d.lookupPath(node, path)
+	}
 	if out.Kind() == reflect.Ptr && !out.IsNil() {
 		out = out.Elem()
+		if d.resetTargets {
+			out.Set(reflect.Zero(out.Type()))
+		}
 	}
 	d.unmarshal(node, out)
 	if len(d.terrors) > 0 {
@@ -134,11 +930,166 @@ func (dec *Decoder) Decode(v interface{}) (err error) {
 	return nil
 }
 
-func unmarshal(in []byte, out interface{}, strict bool) (err error) {
+// DecodeValue is like Decode, but stores the value into rv, for callers
+// that build their targets with reflection. If rv is a non-nil pointer,
+// the value is stored into the value it points to, as with Decode, and
+// otherwise rv must be settable, such as the field of an addressable
+// struct.
+func (dec *Decoder) DecodeValue(rv reflect.Value) error {
+	if !rv.IsValid() || !rv.CanSet() && (rv.Kind() != reflect.Ptr || rv.IsNil()) {
+		return errors.New("yaml: DecodeValue needs a settable value or a non-nil pointer")
+	}
+	return dec.decode(context.Background(), "", rv)
+}
+
+// More reports whether another document follows in the input, so that
+// a call to Decode would not return io.EOF. It reads ahead in the input
+// as necessary, and returns true if that fails, leaving the error to be
+// returned by the next call to Decode.
+func (dec *Decoder) More() bool {
+	if dec.err != nil {
+		return true
+	}
+	var eof bool
+	func() {
+		defer handleErr(&dec.err)
+		dec.parser.init()
+		eof = dec.parser.peek() == yaml_STREAM_END_EVENT
+	}()
+	return !eof
+}
+
+// DecodeAll decodes every remaining document in the input into a new
+// element appended to the slice pointed to by v. Type errors don't stop
+// decoding; they are collected into a single TypeError whose entries
+// are prefixed with the number, starting at 1, of the document they
+// were found in. Warnings are prefixed the same way.
+func (dec *Decoder) DecodeAll(v interface{}) error {
+	out := reflect.ValueOf(v)
+	if out.Kind() != reflect.Ptr || out.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("yaml: DecodeAll needs a pointer to a slice, not %T", v)
+	}
+	slice := out.Elem()
+	var terrors, warnings []string
+	defer func() { dec.warnings = warnings }()
+	for i := 1; ; i++ {
+		elem := reflect.New(slice.Type().Elem())
+		err := dec.Decode(elem.Interface())
+		if err == io.EOF {
+			break
+		}
+		for _, w := range dec.warnings {
+			warnings = append(warnings, fmt.Sprintf("document %d: %s", i, w))
+		}
+		if e, ok := err.(*TypeError); ok {
+			for _, msg := range e.Errors {
+				terrors = append(terrors, fmt.Sprintf("document %d: %s", i, msg))
+			}
+		} else if err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+	if len(terrors) > 0 {
+		return &TypeError{terrors}
+	}
+	return nil
+}
+
+// A SeqDecoder decodes the items of a sequence at the top level of a
+// document one at a time, so that only the current item is held in
+// memory. It is created by Decoder.Seq.
+type SeqDecoder struct {
+	dec     *Decoder
+	item    *node
+	started bool
+	done    bool
+	err     error
+}
+
+// Seq returns a SeqDecoder for the items of the next document read by
+// dec, which must hold a sequence. Once all items have been read, dec
+// may be used to decode the following documents.
+func (dec *Decoder) Seq() *SeqDecoder {
+	return &SeqDecoder{dec: dec}
+}
+
+// Next advances to the next item of the sequence, reporting whether
+// there is one. It returns false at the end of the sequence or when
+// an error occurs, which Err then returns.
+func (s *SeqDecoder) Next() (more bool) {
+	if s.done || s.err != nil {
+		return false
+	}
+	defer handleErr(&s.err)
+	p := s.dec.parser
+	if !s.started {
+		s.started = true
+		p.init()
+		if p.peek() == yaml_STREAM_END_EVENT {
+			s.err = io.EOF
+			return false
+		}
+		p.countDocument()
+		p.doc = p.node(documentNode)
+		p.doc.anchors = make(map[string]*node)
+		p.expect(yaml_DOCUMENT_START_EVENT)
+		if p.peek() != yaml_SEQUENCE_START_EVENT {
+			failf("%sdocument does not hold a sequence", lineLabel(p.filename, p.event.start_mark.line+1+p.lineOffset))
+		}
+		p.expect(yaml_SEQUENCE_START_EVENT)
+		p.enter()
+	}
+	if p.peek() == yaml_SEQUENCE_END_EVENT {
+		p.depth--
+		p.expect(yaml_SEQUENCE_END_EVENT)
+		p.expect(yaml_DOCUMENT_END_EVENT)
+		s.item = nil
+		s.done = true
+		return false
+	}
+	s.item = p.parse()
+	return true
+}
+
+// Decode stores the current item into the value pointed to by v, as
+// Decoder.Decode does for a whole document.
+func (s *SeqDecoder) Decode(v interface{}) (err error) {
+	if s.item == nil {
+		return errors.New("yaml: Decode called without a successful call to Next")
+	}
+	d := newDecoder(s.dec.opts)
+	d.source = s.dec.parser.source
+	d.parser = s.dec.parser
+	defer func() { s.dec.warnings = d.warnings }()
 	defer handleErr(&err)
-	d := newDecoder(strict)
+	out := reflect.ValueOf(v)
+	if out.Kind() == reflect.Ptr && !out.IsNil() {
+		out = out.Elem()
+		if d.resetTargets {
+			out.Set(reflect.Zero(out.Type()))
+		}
+	}
+	d.unmarshal(s.item, out)
+	if len(d.terrors) > 0 {
+		return &TypeError{d.terrors}
+	}
+	return nil
+}
+
+// Err returns the error that stopped Next, if any. It returns io.EOF
+// if there was no document left to read.
+func (s *SeqDecoder) Err() error {
+	return s.err
+}
+
+func unmarshal(in []byte, out interface{}, opts decodeOptions) (err error) {
+	defer handleErr(&err)
+	d := newDecoder(opts)
 	p := newParser(in)
+	p.filename = opts.filename
 	defer p.destroy()
+	d.parser = p
 	node := p.parse()
 	if node != nil {
 		v := reflect.ValueOf(out)
@@ -176,14 +1127,88 @@ func unmarshal(in []byte, out interface{}, strict bool) (err error) {
 //                  fields are zero, unless they implement an IsZero
 //                  method (see the IsZeroer interface type), in which
 //                  case the field will be excluded if IsZero returns true.
+//                  The method may have a pointer receiver.
+//
+//     omitzero     Only include the field if it's not set to the zero
+//                  value for its type, as reported by its IsZero method
+//                  if it has one. Unlike with omitempty, empty but
+//                  non-nil slices and maps are included, and structs
+//                  are zero only if all their fields are, private
+//                  ones included.
 //
 //     flow         Marshal using a flow style (useful for structs,
 //                  sequences and maps).
 //
+//     literal      Marshal the strings held by the field's value in
+//                  the literal block style (|), or in the folded block
+//                  style (>) with the folded flag, where YAML allows
+//                  it, whether or not they span several lines.
+//
 //     inline       Inline the field, which must be a struct or a map,
 //                  causing all of its fields or keys to be processed as if
 //                  they were part of the outer struct. For maps, keys must
 //                  not conflict with the yaml keys of other struct fields.
+//                  When unmarshalling, an inlined map receives every key
+//                  that matches no other field, so it is never reported
+//                  as unknown in strict mode. A struct may hold a single
+//                  inlined map, directly or within an inlined struct;
+//                  fields always take precedence over the map, wherever
+//                  they are inlined from. Conflicting keys are reported
+//                  as a *StructError.
+//
+//     required     Unmarshal reports an error if the key is missing from
+//                  a mapping decoded into the struct. It has no effect
+//                  on marshalling.
+//
+//     strict       Unmarshal the field's value strictly (see
+//                  UnmarshalStrict), whatever the decoder's setting.
+//
+//     lenient      Unmarshal the field's value non-strictly, whatever
+//                  the decoder's setting.
+//
+//     exact        Unmarshal reports numbers that the field's value
+//                  cannot hold without loss as errors (see
+//                  Decoder.SetExactNumbers).
+//
+//     alias=<key>  Unmarshal also accepts key for the field, reporting
+//                  a warning through Decoder.Warnings when it's used.
+//                  The flag may be repeated. It has no effect on
+//                  marshalling.
+//
+//     default=<v>  Unmarshal decodes the YAML value v into the field if
+//                  the key is missing from a mapping decoded into the
+//                  struct and the field holds its zero value, so values
+//                  set before unmarshalling are kept. The value may be
+//                  a flow collection, such as [a] or {x: 1}, but cannot
+//                  contain commas. Values that do not parse or decode
+//                  into the field are reported as a *StructError. A
+//                  field with a default is never reported as a missing
+//                  required field. It has no effect on marshalling,
+//                  unless the encoder writes skeletons (see
+//                  Encoder.SetSkeleton).
+//
+//     pos          The field, which must have type Position, is not
+//                  mapped to a key. Unmarshal sets it to the position of
+//                  the mapping decoded into the struct.
+//
+//     format=<l>   Marshal and unmarshal a time.Time field, or the
+//                  time.Time values it holds, using the layout l as
+//                  understood by time.Format and time.Parse rather
+//                  than RFC 3339. The layout cannot contain commas.
+//
+//     bytes=<f>    Marshal and unmarshal the byte slices held by the
+//                  field's value in the format f, which is base64, hex
+//                  or string (see the BytesFormat constants), whatever
+//                  the format of the encoder or decoder.
+//
+//     comment=<c>  Marshal writes c as a comment on the line before
+//                  the key, or on several lines if c holds newlines,
+//                  unless the field is written in flow style. The
+//                  comment of the first key of a sequence item is
+//                  written before its dash. The flag must come last,
+//                  as the comment runs to the end of the tag and so
+//                  may contain commas. It has no effect on
+//                  unmarshalling.
 //
 // In addition, if the key is "-", the field is ignored.
 //
@@ -206,6 +1231,35 @@ func Marshal(in interface{}) (out []byte, err error) {
 	return
 }
 
+// MarshalAppend appends the YAML encoding of in to dst and returns
+// the extended buffer. See Marshal for details about the conversion.
+func MarshalAppend(dst []byte, in interface{}) (out []byte, err error) {
+	defer handleErr(&err)
+	e := newEncoder()
+	defer e.destroy()
+	e.out = dst
+	e.marshalDoc("", reflect.ValueOf(in))
+	e.finish()
+	out = e.out
+	return
+}
+
+// MarshalAll serializes each of the values as a separate document of
+// a YAML stream, with the documents after the first preceded by a "---"
+// separator. Nil values are written as null documents.
+func MarshalAll(in []interface{}) (out []byte, err error) {
+	defer handleErr(&err)
+	e := newEncoder()
+	defer e.destroy()
+	e.init()
+	for _, v := range in {
+		e.marshalDoc("", reflect.ValueOf(v))
+	}
+	e.finish()
+	out = e.out
+	return
+}
+
 // An Encoder writes YAML values to an output stream.
 type Encoder struct {
 	encoder *encoder
@@ -220,6 +1274,348 @@ func NewEncoder(w io.Writer) *Encoder {
 	}
 }
 
+// SetSchema sets the rules used to decide whether strings must be
+// quoted so that they are not read back as another type. By default,
+// YAML 1.1 rules are used, which quote strings such as yes and off.
+func (e *Encoder) SetSchema(schema Schema) {
+	e.encoder.schema = schema
+}
+
+// SetIndent sets the number of spaces used for each level of
+// indentation, from 2 to 9. Values out of that range stand for the
+// default of 2.
+func (e *Encoder) SetIndent(spaces int) {
+	yaml_emitter_set_indent(&e.encoder.emitter, spaces)
+}
+
+// SetLineWidth sets the preferred width of output lines, beyond which
+// long scalars are folded onto several lines where YAML allows it. By
+// default lines are folded at 80 columns, unless FutureLineWrap was
+// called. A width of zero or less means lines are never folded, and
+// widths no greater than twice the indentation stand for 80.
+func (e *Encoder) SetLineWidth(width int) {
+	if width <= 0 {
+		width = -1
+	}
+	yaml_emitter_set_width(&e.encoder.emitter, width)
+}
+
+// SetIndentSequences sets whether block sequences that are the values
+// of mapping keys are indented under their key, as in
+//
+//	key:
+//	  - item
+//
+// rather than written at the indentation of the key, which is the
+// default:
+//
+//	key:
+//	- item
+//
+// Sequences nested in sequences are always indented by the width of
+// the "- " indicator.
+func (e *Encoder) SetIndentSequences(enabled bool) {
+	yaml_emitter_set_indent_sequences(&e.encoder.emitter, enabled)
+}
+
+// KeyOrder is the order in which an Encoder writes the keys of maps.
+type KeyOrder int
+
+const (
+	// NaturalOrder sorts numbers and booleans by value before other
+	// keys, and compares strings by their letters and the numeric value
+	// of their runs of digits, so that "a2" comes before "a10". This is
+	// the default.
+	NaturalOrder KeyOrder = iota
+
+	// LexicalOrder is like NaturalOrder, but compares strings byte by
+	// byte, so that "a10" comes before "a2" and "B" before "a".
+	LexicalOrder
+)
+
+// SetKeyOrder sets the order in which the keys of maps are written.
+// It replaces any function set by SetKeyLess.
+func (e *Encoder) SetKeyOrder(order KeyOrder) {
+	switch order {
+	case LexicalOrder:
+		e.encoder.keyLess = lexicalLess
+	default:
+		e.encoder.keyLess = nil
+	}
+}
+
+// SetKeyLess sets a function reporting whether the map key a is
+// written before the key b, in place of the key order. The keys are
+// passed as held by the maps, such as a string for the keys of a
+// map[string]int. A nil function restores the natural order.
+func (e *Encoder) SetKeyLess(less func(a, b interface{}) bool) {
+	if less == nil {
+		e.encoder.keyLess = nil
+		return
+	}
+	e.encoder.keyLess = func(a, b reflect.Value) bool {
+		return less(a.Interface(), b.Interface())
+	}
+}
+
+// SetSortFields sets whether the fields of structs are written in the
+// order of their keys, as set by SetKeyOrder or SetKeyLess, rather than
+// in the order they are declared. The keys of inlined maps still follow
+// all fields.
+func (e *Encoder) SetSortFields(enabled bool) {
+	e.encoder.sortFields = enabled
+}
+
+// SetAutoAnchors sets whether the values of pointers and maps that are
+// referenced more than once in a document are written only at their
+// first reference, with an anchor that the other references name as
+// aliases. It allows marshalling values with cycles, which otherwise
+// recurse forever. Anchors are named by name, which is passed a count
+// of the anchors in the document, from 1, and the pointer or map; a nil
+// name uses "a1", "a2" and so on.
+func (e *Encoder) SetAutoAnchors(enabled bool, name func(n int, v interface{}) string) {
+	switch {
+	case !enabled:
+		e.encoder.anchorName = nil
+	case name != nil:
+		e.encoder.anchorName = name
+	default:
+		e.encoder.anchorName = func(n int, v interface{}) string { return fmt.Sprintf("a%d", n) }
+	}
+}
+
+// SetCanonical sets whether the output is in the canonical form of
+// YAML, which writes out the tag of every node, double-quotes all
+// scalars, uses the flow style for all collections and marks the start
+// of every document. Its output doesn't depend on the quoting and
+// style settings, and is unambiguous, which makes it suitable for
+// hashing or signing.
+func (e *Encoder) SetCanonical(enabled bool) {
+	e.encoder.canonical = enabled
+	yaml_emitter_set_canonical(&e.encoder.emitter, enabled)
+}
+
+// SetNumericDurations sets whether time.Duration values are written as
+// integers of nanoseconds, as older releases did, rather than in the
+// format of Duration.String, such as 1h30m0s. Both are accepted when
+// unmarshalling.
+func (e *Encoder) SetNumericDurations(enabled bool) {
+	e.encoder.numericDurations = enabled
+}
+
+// SetExplicitEmpty sets whether empty slices and maps that are not nil
+// are always written, as [] and {}, even as the values of struct fields
+// with the omitempty flag. Nil slices and maps are still omitted from
+// these fields, which tells explicitly empty collections from absent
+// ones.
+func (e *Encoder) SetExplicitEmpty(enabled bool) {
+	e.encoder.explicitEmpty = enabled
+}
+
+// SetFloatFormat sets the format and precision of floats, as
+// understood by strconv.FormatFloat: the format 'f' never uses
+// scientific notation, for instance. By default floats are written
+// with the format 'g' and the smallest precision that represents them
+// exactly. Formats other than 'e', 'E', 'f', 'g' and 'G' cause a
+// panic.
+func (e *Encoder) SetFloatFormat(format byte, precision int) {
+	switch format {
+	case 'e', 'E', 'f', 'g', 'G':
+	default:
+		panic(fmt.Sprintf("yaml: invalid float format %q", format))
+	}
+	e.encoder.floatFormat = format
+	e.encoder.floatPrec = precision
+}
+
+// SetFloatPoint sets whether floats holding whole numbers are written
+// with a decimal point, as 1.0 rather than 1, so that they are read
+// back as floats rather than integers.
+func (e *Encoder) SetFloatPoint(enabled bool) {
+	e.encoder.floatPoint = enabled
+}
+
+// SetBytesFormat sets how byte slices are written, unless their struct
+// field has the bytes flag. By default they are written as sequences of
+// integers.
+func (e *Encoder) SetBytesFormat(f BytesFormat) {
+	e.encoder.bytes = f
+}
+
+// SetNullValue sets how nil values are written: as "null", "~" or,
+// with "", as nothing at all where YAML allows it and as null
+// elsewhere, such as in flow collections. Nil pointers and interfaces
+// are then written this way, and so are nil maps and slices, which are
+// written as empty collections by default. Other texts cause a panic.
+// JSON compatible output always uses null.
+func (e *Encoder) SetNullValue(text string) {
+	switch text {
+	case "null", "Null", "NULL", "~", "":
+	default:
+		panic(fmt.Sprintf("yaml: %q is not a null value", text))
+	}
+	e.encoder.null = &text
+}
+
+// DocumentMarkers selects the markers an Encoder writes around
+// documents.
+type DocumentMarkers int
+
+const (
+	// MarkBetween writes "---" before every document but the first.
+	// This is the default.
+	MarkBetween DocumentMarkers = iota
+
+	// MarkStart writes "---" before every document, so that streams
+	// written separately can be concatenated into one.
+	MarkStart
+
+	// MarkStartEnd writes "---" before and "..." after every document.
+	MarkStartEnd
+
+	// MarkNone writes no markers. Documents written one after the
+	// other then run together, so it's meant for encoders writing a
+	// single document each.
+	MarkNone
+
+	// MarkEnd writes "..." after every document, and "---" before
+	// every document but the first.
+	MarkEnd
+)
+
+// SetDocumentMarkers sets the markers written around documents.
+func (e *Encoder) SetDocumentMarkers(m DocumentMarkers) {
+	e.encoder.markers = m
+	yaml_emitter_set_implicit_documents(&e.encoder.emitter, m == MarkNone)
+}
+
+// SetFinalNewline sets whether the output ends with a line break,
+// which is the default. When disabled, the line break ending each
+// document is only written once another document follows, so that the
+// stream ends right after the last value or "..." marker. The line
+// breaks of literal and block scalars are always written.
+func (e *Encoder) SetFinalNewline(enabled bool) {
+	yaml_emitter_set_final_break(&e.encoder.emitter, enabled)
+}
+
+// SetJSONCompatible sets whether the output is restricted to the
+// subset of YAML that is also JSON: collections in flow style,
+// strings and mapping keys double-quoted, and neither tags nor
+// anchors, so that each document can be read by a JSON parser. Values
+// that JSON cannot represent, such as infinite floats and mappings
+// used as keys, are reported as errors. Comments are not written.
+func (e *Encoder) SetJSONCompatible(enabled bool) {
+	e.encoder.json = enabled
+}
+
+// Quoting selects when an Encoder quotes strings.
+type Quoting int
+
+const (
+	// QuoteWhenNeeded quotes the strings that the encoder's schema
+	// would otherwise read back as another type, such as "true" or
+	// "1.5". This is the default.
+	QuoteWhenNeeded Quoting = iota
+
+	// QuoteSafe also quotes the strings that any of the schemas
+	// would read as another type, such as "no" and "on" with
+	// SchemaCore, so that the output means the same to parsers
+	// following either YAML 1.1 or YAML 1.2.
+	QuoteSafe
+
+	// QuoteAlways quotes all strings, keys included.
+	QuoteAlways
+)
+
+// SetQuoting sets when strings are quoted. Strings holding newlines
+// keep the multiline style (see SetMultilineStyle), and the literal and
+// folded flags of struct fields take precedence.
+func (e *Encoder) SetQuoting(q Quoting) {
+	e.encoder.quoting = q
+}
+
+// SetQuoteStyle sets the quotes used for strings: DoubleQuotedStyle,
+// the default, or SingleQuotedStyle. Other styles stand for
+// DoubleQuotedStyle. Strings that single quotes cannot represent, such
+// as those holding control characters, are always double-quoted.
+func (e *Encoder) SetQuoteStyle(style Style) {
+	e.encoder.quoteStyle = yaml_DOUBLE_QUOTED_SCALAR_STYLE
+	if style == SingleQuotedStyle {
+		e.encoder.quoteStyle = yaml_SINGLE_QUOTED_SCALAR_STYLE
+	}
+}
+
+// SetMultilineStyle sets the style of the strings holding newlines:
+// LiteralStyle, the default, FoldedStyle or DoubleQuotedStyle. Other
+// styles stand for LiteralStyle. The literal and folded flags of
+// struct fields take precedence.
+func (e *Encoder) SetMultilineStyle(style Style) {
+	switch style {
+	case FoldedStyle:
+		e.encoder.multiline = yaml_FOLDED_SCALAR_STYLE
+	case DoubleQuotedStyle:
+		e.encoder.multiline = yaml_DOUBLE_QUOTED_SCALAR_STYLE
+	default:
+		e.encoder.multiline = yaml_LITERAL_SCALAR_STYLE
+	}
+}
+
+// SetFlowWidth sets the width under which maps and sequences holding
+// only scalars are written in flow style, as in
+//
+//	labels: {app: web, tier: frontend}
+//	ports: [80, 443]
+//
+// when they are nested in another map or sequence and their flow
+// encoding is at most width bytes long. A width of zero or less, the
+// default, leaves such collections in block style unless their field
+// has the flow flag.
+func (e *Encoder) SetFlowWidth(width int) {
+	e.encoder.flowWidth = width
+}
+
+// FlowWrap selects how an Encoder writes flow collections that are
+// longer than the line width.
+type FlowWrap int
+
+const (
+	// FlowFold breaks lines between items and at the spaces within
+	// their scalars. This is the default.
+	FlowFold FlowWrap = iota
+
+	// FlowWrapItems breaks lines between items only.
+	FlowWrapItems
+
+	// FlowOneLine never breaks lines within flow collections.
+	FlowOneLine
+
+	// FlowToBlock writes in block style the collections that would
+	// be written in flow style, such as the values of fields with the
+	// flow flag, when their flow form is longer than the line width.
+	// Lines are still broken between the items of those that fit but
+	// start too far to the right.
+	FlowToBlock
+)
+
+// SetFlowWrap sets how flow collections longer than the line width
+// are written.
+func (e *Encoder) SetFlowWrap(wrap FlowWrap) {
+	e.encoder.flowWrap = wrap
+	yaml_emitter_set_flow_breaks(&e.encoder.emitter, wrap != FlowOneLine, wrap == FlowFold)
+}
+
+// SetJSONTags sets whether the json tags of struct fields are used as
+// their yaml tags when they have none (see Decoder.SetJSONTags).
+func (e *Encoder) SetJSONTags(enabled bool) {
+	e.encoder.jsonTags = enabled
+}
+
+// SetInlineEmbedded sets whether anonymous struct fields without a key
+// in their tag are inlined (see Decoder.SetInlineEmbedded).
+func (e *Encoder) SetInlineEmbedded(enabled bool) {
+	e.encoder.embedInline = enabled
+}
+
 // Encode writes the YAML encoding of v to the stream.
 // If multiple items are encoded to the stream, the
 // second and subsequent document will be preceded
@@ -233,6 +1629,138 @@ func (e *Encoder) Encode(v interface{}) (err error) {
 	return nil
 }
 
+// EncodeAll writes the YAML encoding of each of the values to the
+// stream as a separate document, as Encode does. Nil values are written
+// as null documents.
+func (e *Encoder) EncodeAll(values ...interface{}) (err error) {
+	defer handleErr(&err)
+	for _, v := range values {
+		e.encoder.marshalDoc("", reflect.ValueOf(v))
+	}
+	return nil
+}
+
+// BeginSeq starts a document holding a sequence, whose items are then
+// written one at a time by EncodeItem until EndSeq is called. Unlike
+// encoding a slice, it doesn't need all items to be held in memory at
+// once, and the output is flushed after each item. Encode cannot be
+// called while the sequence is open.
+func (e *Encoder) BeginSeq() (err error) {
+	defer handleErr(&err)
+	e.encoder.beginSeq()
+	return nil
+}
+
+// EncodeItem writes the YAML encoding of v as the next item of the
+// sequence started by BeginSeq.
+func (e *Encoder) EncodeItem(v interface{}) (err error) {
+	defer handleErr(&err)
+	e.encoder.item(reflect.ValueOf(v))
+	return nil
+}
+
+// EndSeq ends the sequence started by BeginSeq and its document.
+func (e *Encoder) EndSeq() (err error) {
+	defer handleErr(&err)
+	e.encoder.endSeq()
+	return nil
+}
+
+// SetSkeleton sets whether struct values are written as skeletons,
+// such as the template of a configuration file for users to fill in.
+// All fields are then written, whatever their omitempty and omitzero
+// flags, zero fields with a default flag are written with their
+// default, and nil pointers to structs are written as the zero value
+// of the struct, so that nested fields appear too. Fields with a
+// comment flag keep their comment.
+func (e *Encoder) SetSkeleton(enabled bool) {
+	e.encoder.skeleton = enabled
+}
+
+// SetSectionComments sets a function returning the comment written
+// before each key of the top-level mapping of a document, such as a
+// banner naming a section of a generated configuration file. The key
+// is passed as it is held in the map or, for structs, as the string
+// key of the field. Comments after the first key are preceded by a
+// blank line, and come before the comment of the field, if any. An
+// empty comment writes nothing, and comments are not written in flow
+// style.
+func (e *Encoder) SetSectionComments(comment func(key interface{}) string) {
+	e.encoder.sectionComment = comment
+}
+
+// SetExplicitTags sets whether the resolved tag of every node is
+// written out, such as !!str, !!int or !!map, while keeping the
+// styles of the usual output. It helps when debugging how untagged
+// values are resolved, and makes documents unambiguous for parsers
+// with other resolution rules.
+func (e *Encoder) SetExplicitTags(enabled bool) {
+	e.encoder.explicitTags = enabled
+}
+
+// SetVersionDirective sets the version written in a %YAML directive
+// before each document, which must be 1.1 or 1.2. Documents with a
+// directive always start with a "---" marker. A version of 0.0, the
+// default, writes no directive.
+func (e *Encoder) SetVersionDirective(major, minor int) {
+	switch {
+	case major == 0 && minor == 0:
+		e.encoder.version = nil
+	case major == 1 && (minor == 1 || minor == 2):
+		e.encoder.version = &yaml_version_directive_t{major: int8(major), minor: int8(minor)}
+	default:
+		panic(fmt.Sprintf("yaml: unsupported YAML version %d.%d", major, minor))
+	}
+}
+
+// RegisterTagHandle registers a %TAG directive written before each
+// document, which makes handle, such as "!e!", stand for prefix, such
+// as "tag:example.com,2000:". Tags starting with prefix are then
+// written with the handle in their place. Registering a handle again
+// replaces its prefix.
+func (e *Encoder) RegisterTagHandle(handle, prefix string) {
+	directives := make([]yaml_tag_directive_t, 0, len(e.encoder.tagDirectives)+1)
+	for _, d := range e.encoder.tagDirectives {
+		if string(d.handle) != handle {
+			directives = append(directives, d)
+		}
+	}
+	directives = append(directives, yaml_tag_directive_t{handle: []byte(handle), prefix: []byte(prefix)})
+	e.encoder.tagDirectives = directives
+}
+
+// SetScalarKeys sets whether map keys must be written as scalars.
+// When enabled, encoding a map whose key is written as a collection,
+// such as an array or a struct, or whose key type can't be marshalled
+// at all, fails with an error instead of writing a complex key or
+// panicking. Map keys are always written in the same order, whatever
+// their types.
+func (e *Encoder) SetScalarKeys(enabled bool) {
+	e.encoder.scalarKeys = enabled
+}
+
+// RegisterType registers the given tag, such as "!secret", as the tag
+// written for the values of the type of v, so that they are read back
+// by a Decoder with the same type registered. The tag is written before
+// whatever the value marshals into, including the result of its
+// MarshalYAML or MarshalText method.
+func (e *Encoder) RegisterType(tag string, v interface{}) {
+	tags := make(map[reflect.Type]string, len(e.encoder.tags)+1)
+	for typ, t := range e.encoder.tags {
+		tags[typ] = t
+	}
+	tags[reflect.TypeOf(v)] = longTag(tag)
+	e.encoder.tags = tags
+}
+
+// Reset discards the state of the encoder and makes it write a new
+// stream to w, keeping its settings. It allows an encoder to be reused
+// without allocating a new one; call Close first to write any
+// remaining data.
+func (e *Encoder) Reset(w io.Writer) {
+	e.encoder.reset(w)
+}
+
 // Close closes the encoder by writing any remaining data.
 // It does not write a stream terminating string "...".
 func (e *Encoder) Close() (err error) {
@@ -275,6 +1803,24 @@ func (e *TypeError) Error() string {
 	return fmt.Sprintf("yaml: unmarshal errors:\n  %s", strings.Join(e.Errors, "\n  "))
 }
 
+// A StructError is returned by Marshal and Unmarshal when the fields
+// of a struct type cannot be mapped to YAML keys, such as when two of
+// its fields have the same key, or when a key of its inlined map is
+// also the key of one of its fields.
+type StructError struct {
+	// Type is the struct type.
+	Type reflect.Type
+	// Key is the conflicting key, if the problem is a conflict,
+	// or the key of the field with an invalid default value.
+	Key string
+	// Msg describes the problem.
+	Msg string
+}
+
+func (e *StructError) Error() string {
+	return e.Msg
+}
+
 // --------------------------------------------------------------------------
 // Maintain a mapping of keys to structure field indexes
 
@@ -286,16 +1832,56 @@ type structInfo struct {
 	FieldsMap  map[string]fieldInfo
 	FieldsList []fieldInfo
 
-	// InlineMap is the number of the field in the struct that
-	// contains an ,inline map, or -1 if there's none.
-	InlineMap int
+	// InlineMap is the index sequence of the field that holds the
+	// ,inline map, within the struct or its inlined structs, or nil
+	// if there's none.
+	InlineMap []int
+
+	// FoldedMap maps the lowercased keys of fields to the fields,
+	// for keys that are unique when case is ignored.
+	FoldedMap map[string]fieldInfo
+
+	// Required and Defaults hold whether any field has the
+	// ,required flag or a default value, respectively.
+	Required bool
+	Defaults bool
+
+	// PosField is the number of the field in the struct that has
+	// the ,pos flag, or -1 if there's none.
+	PosField int
 }
 
 type fieldInfo struct {
 	Key       string
 	Num       int
 	OmitEmpty bool
+	OmitZero  bool
 	Flow      bool
+	Required  bool
+	// Default holds the YAML value decoded into the field
+	// when its key is missing, if set, and DefaultNode holds
+	// that value parsed.
+	Default     string
+	DefaultNode *node
+	// Aliases holds alternative keys accepted when unmarshalling.
+	Aliases []string
+	// Strict and Lenient override the strictness of the decoder
+	// while unmarshalling the field's value.
+	Strict  bool
+	Lenient bool
+	// Exact holds whether lossy numeric conversions are rejected
+	// while unmarshalling the field's value.
+	Exact bool
+	// Format holds the time layout used for time.Time values, if set.
+	Format string
+	// Comment holds the comment written before the key, if set.
+	Comment string
+	// Style holds the style of the strings marshalled from the
+	// field's value, if set by the literal or folded flag.
+	Style yaml_scalar_style_t
+	// Bytes holds the format of the byte slices in the field's
+	// value, if set by the bytes flag.
+	Bytes BytesFormat
 	// Id holds the unique field identifier, so we can cheaply
 	// check for field duplicates without maintaining an extra map.
 	Id int
@@ -304,12 +1890,26 @@ type fieldInfo struct {
 	Inline []int
 }
 
-var structMap = make(map[reflect.Type]*structInfo)
+// keys returns the key of the field followed by its aliases.
+func (info *fieldInfo) keys() []string {
+	return append([]string{info.Key}, info.Aliases...)
+}
+
+// structKey identifies the struct information of a type, which
+// depends on whether json tags are used for fields without yaml tags
+// and whether embedded structs are inlined by default.
+type structKey struct {
+	t           reflect.Type
+	jsonTags    bool
+	embedInline bool
+}
+
+var structMap = make(map[structKey]*structInfo)
 var fieldMapMutex sync.RWMutex
 
-func getStructInfo(st reflect.Type) (*structInfo, error) {
+func getStructInfo(st reflect.Type, jsonTags, embedInline bool) (*structInfo, error) {
 	fieldMapMutex.RLock()
-	sinfo, found := structMap[st]
+	sinfo, found := structMap[structKey{st, jsonTags, embedInline}]
 	fieldMapMutex.RUnlock()
 	if found {
 		return sinfo, nil
@@ -318,7 +1918,12 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 	n := st.NumField()
 	fieldsMap := make(map[string]fieldInfo)
 	fieldsList := make([]fieldInfo, 0, n)
-	inlineMap := -1
+	var inlineMap []int
+	// embedded holds the positions in fieldsList of the fields
+	// of implicitly inlined embedded structs, which are resolved
+	// once all the other fields are known.
+	embedded := make(map[int]bool)
+	posField := -1
 	for i := 0; i != n; i++ {
 		field := st.Field(i)
 		if field.PkgPath != "" && !field.Anonymous {
@@ -327,7 +1932,10 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 
 		info := fieldInfo{Num: i}
 
-		tag := field.Tag.Get("yaml")
+		tag, found := field.Tag.Lookup("yaml")
+		if !found && jsonTags {
+			tag = jsonTag(field.Tag.Get("json"))
+		}
 		if tag == "" && strings.Index(string(field.Tag), ":") < 0 {
 			tag = string(field.Tag)
 		}
@@ -335,56 +1943,142 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 			continue
 		}
 
-		inline := false
+		inline, pos := false, false
 		fields := strings.Split(tag, ",")
 		if len(fields) > 1 {
-			for _, flag := range fields[1:] {
+			for i, flag := range fields[1:] {
+				if strings.HasPrefix(flag, "comment=") {
+					// The comment runs to the end of the tag.
+					info.Comment = strings.Join(fields[1+i:], ",")[len("comment="):]
+					break
+				}
+				if strings.HasPrefix(flag, "default=") {
+					info.Default = flag[len("default="):]
+					n, err := parseDefault(info.Default)
+					if err == nil && n == nil {
+						err = errors.New("no value")
+					}
+					if err != nil {
+						msg := fmt.Sprintf("Invalid default in tag %q of type %s: %s", tag, st, strings.TrimPrefix(err.Error(), "yaml: "))
+						return nil, &StructError{Type: st, Msg: msg}
+					}
+					info.DefaultNode = n
+					continue
+				}
+				if strings.HasPrefix(flag, "format=") {
+					info.Format = flag[len("format="):]
+					continue
+				}
+				if strings.HasPrefix(flag, "bytes=") {
+					format, ok := bytesFormats[flag[len("bytes="):]]
+					if !ok {
+						return nil, &StructError{Type: st, Msg: fmt.Sprintf("Unsupported bytes format %q in tag %q of type %s", flag[len("bytes="):], tag, st)}
+					}
+					info.Bytes = format
+					continue
+				}
+				if strings.HasPrefix(flag, "alias=") {
+					info.Aliases = append(info.Aliases, flag[len("alias="):])
+					continue
+				}
 				switch flag {
 				case "omitempty":
 					info.OmitEmpty = true
+				case "omitzero":
+					info.OmitZero = true
 				case "flow":
 					info.Flow = true
 				case "inline":
 					inline = true
+				case "required":
+					info.Required = true
+				case "strict":
+					info.Strict = true
+				case "lenient":
+					info.Lenient = true
+				case "pos":
+					pos = true
+				case "exact":
+					info.Exact = true
+				case "literal", "folded":
+					if info.Style != 0 {
+						return nil, &StructError{Type: st, Msg: fmt.Sprintf("Flags literal and folded are exclusive in tag %q of type %s", tag, st)}
+					}
+					info.Style = yaml_LITERAL_SCALAR_STYLE
+					if flag == "folded" {
+						info.Style = yaml_FOLDED_SCALAR_STYLE
+					}
 				default:
-					return nil, errors.New(fmt.Sprintf("Unsupported flag %q in tag %q of type %s", flag, tag, st))
+					return nil, &StructError{Type: st, Msg: fmt.Sprintf("Unsupported flag %q in tag %q of type %s", flag, tag, st)}
 				}
 			}
+			if info.Strict && info.Lenient {
+				return nil, &StructError{Type: st, Msg: fmt.Sprintf("Flags strict and lenient are exclusive in tag %q of type %s", tag, st)}
+			}
 			tag = fields[0]
 		}
 
+		implicit := false
+		if embedInline && !inline && field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			inline, implicit = true, true
+		}
+
+		if pos {
+			if field.Type != positionType {
+				return nil, &StructError{Type: st, Msg: "Option ,pos needs a yaml.Position field in struct " + st.String()}
+			}
+			if posField >= 0 {
+				return nil, &StructError{Type: st, Msg: "Multiple ,pos fields in struct " + st.String()}
+			}
+			posField = i
+			continue
+		}
+
 		if inline {
 			switch field.Type.Kind() {
 			case reflect.Map:
-				if inlineMap >= 0 {
-					return nil, errors.New("Multiple ,inline maps in struct " + st.String())
+				if inlineMap != nil {
+					return nil, &StructError{Type: st, Msg: "Multiple ,inline maps in struct " + st.String()}
 				}
 				if field.Type.Key() != reflect.TypeOf("") {
-					return nil, errors.New("Option ,inline needs a map with string keys in struct " + st.String())
+					return nil, &StructError{Type: st, Msg: "Option ,inline needs a map with string keys in struct " + st.String()}
 				}
-				inlineMap = info.Num
+				inlineMap = []int{info.Num}
 			case reflect.Struct:
-				sinfo, err := getStructInfo(field.Type)
+				sinfo, err := getStructInfo(field.Type, jsonTags, embedInline)
 				if err != nil {
 					return nil, err
 				}
-				for _, finfo := range sinfo.FieldsList {
-					if _, found := fieldsMap[finfo.Key]; found {
-						msg := "Duplicated key '" + finfo.Key + "' in struct " + st.String()
-						return nil, errors.New(msg)
+				if sinfo.InlineMap != nil {
+					if inlineMap != nil {
+						return nil, &StructError{Type: st, Msg: "Multiple ,inline maps in struct " + st.String()}
 					}
+					inlineMap = append([]int{i}, sinfo.InlineMap...)
+				}
+				for _, finfo := range sinfo.FieldsList {
 					if finfo.Inline == nil {
 						finfo.Inline = []int{i, finfo.Num}
 					} else {
 						finfo.Inline = append([]int{i}, finfo.Inline...)
 					}
 					finfo.Id = len(fieldsList)
-					fieldsMap[finfo.Key] = finfo
+					if implicit {
+						embedded[finfo.Id] = true
+						fieldsList = append(fieldsList, finfo)
+						continue
+					}
+					for _, key := range finfo.keys() {
+						if _, found := fieldsMap[key]; found {
+							msg := "Duplicated key '" + key + "' in struct " + st.String()
+							return nil, &StructError{Type: st, Key: key, Msg: msg}
+						}
+						fieldsMap[key] = finfo
+					}
 					fieldsList = append(fieldsList, finfo)
 				}
 			default:
 				//return nil, errors.New("Option ,inline needs a struct value or map field")
-				return nil, errors.New("Option ,inline needs a struct value field")
+				return nil, &StructError{Type: st, Msg: "Option ,inline needs a struct value field"}
 			}
 			continue
 		}
@@ -395,28 +2089,136 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 			info.Key = strings.ToLower(field.Name)
 		}
 
-		if _, found = fieldsMap[info.Key]; found {
-			msg := "Duplicated key '" + info.Key + "' in struct " + st.String()
-			return nil, errors.New(msg)
-		}
-
 		info.Id = len(fieldsList)
+		for _, key := range info.keys() {
+			if _, found = fieldsMap[key]; found {
+				msg := "Duplicated key '" + key + "' in struct " + st.String()
+				return nil, &StructError{Type: st, Key: key, Msg: msg}
+			}
+			fieldsMap[key] = info
+		}
 		fieldsList = append(fieldsList, info)
-		fieldsMap[info.Key] = info
+	}
+
+	if len(embedded) > 0 {
+		fieldsList = resolveEmbedded(fieldsMap, fieldsList, embedded)
 	}
 
 	sinfo = &structInfo{
 		FieldsMap:  fieldsMap,
 		FieldsList: fieldsList,
 		InlineMap:  inlineMap,
+		PosField:   posField,
+	}
+	sinfo.FoldedMap = make(map[string]fieldInfo, len(fieldsMap))
+	ambiguous := make(map[string]bool)
+	for key, finfo := range fieldsMap {
+		folded := strings.ToLower(key)
+		if _, found := sinfo.FoldedMap[folded]; found || ambiguous[folded] {
+			delete(sinfo.FoldedMap, folded)
+			ambiguous[folded] = true
+			continue
+		}
+		sinfo.FoldedMap[folded] = finfo
+	}
+	for _, finfo := range fieldsList {
+		if finfo.Required {
+			sinfo.Required = true
+		}
+		if finfo.Default != "" {
+			sinfo.Defaults = true
+		}
 	}
 
 	fieldMapMutex.Lock()
-	structMap[st] = sinfo
+	structMap[structKey{st, jsonTags, embedInline}] = sinfo
 	fieldMapMutex.Unlock()
+
+	// Defaults are checked once sinfo is known, as decoding them may
+	// need it, such as for pointers to st. Those of the fields of
+	// inlined structs were checked with their struct.
+	for _, finfo := range fieldsList {
+		if finfo.DefaultNode == nil || finfo.Inline != nil {
+			continue
+		}
+		errs, err := checkDefault(finfo, st.Field(finfo.Num).Type)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		if len(errs) > 0 {
+			fieldMapMutex.Lock()
+			delete(structMap, structKey{st, jsonTags, embedInline})
+			fieldMapMutex.Unlock()
+			msg := fmt.Sprintf("Invalid default %q for field %s of type %s: %s", finfo.Default, finfo.Key, st, strings.TrimPrefix(errs[0], "line 1: "))
+			return nil, &StructError{Type: st, Key: finfo.Key, Msg: msg}
+		}
+	}
 	return sinfo, nil
 }
 
+// resolveEmbedded adds to fieldsMap the keys of the fields of implicitly
+// inlined embedded structs, at the positions in fieldsList marked in
+// embedded, and returns fieldsList without the fields that lost their key.
+// As with encoding/json, a key of another field hides the embedded ones,
+// the shallowest embedded field wins over the deeper ones, and a key held
+// by several embedded fields at the same depth is dropped.
+func resolveEmbedded(fieldsMap map[string]fieldInfo, fieldsList []fieldInfo, embedded map[int]bool) []fieldInfo {
+	winners := make(map[string]int)
+	ties := make(map[string]bool)
+	for i, finfo := range fieldsList {
+		if !embedded[i] {
+			continue
+		}
+		for _, key := range finfo.keys() {
+			if _, found := fieldsMap[key]; found {
+				continue
+			}
+			w, found := winners[key]
+			switch {
+			case !found || len(finfo.Inline) < len(fieldsList[w].Inline):
+				winners[key] = i
+				delete(ties, key)
+			case len(finfo.Inline) == len(fieldsList[w].Inline):
+				ties[key] = true
+			}
+		}
+	}
+	for key := range ties {
+		delete(winners, key)
+	}
+
+	kept := make([]fieldInfo, 0, len(fieldsList))
+	for i, finfo := range fieldsList {
+		if embedded[i] {
+			if w, found := winners[finfo.Key]; !found || w != i {
+				continue
+			}
+		}
+		finfo.Id = len(kept)
+		for _, key := range finfo.keys() {
+			if w, found := winners[key]; embedded[i] && (!found || w != i) {
+				continue
+			}
+			fieldsMap[key] = finfo
+		}
+		kept = append(kept, finfo)
+	}
+	return kept
+}
+
+// jsonTag returns the yaml tag equivalent to the json tag of a field,
+// keeping the options that have the same meaning.
+func jsonTag(tag string) string {
+	fields := strings.Split(tag, ",")
+	yamlTag := fields[0]
+	for _, flag := range fields[1:] {
+		if flag == "omitempty" {
+			yamlTag += ",omitempty"
+		}
+	}
+	return yamlTag
+}
+
 // IsZeroer is used to check whether an object is zero to
 // determine whether it should be omitted when marshaling
 // with the omitempty flag. One notable implementation
@@ -427,7 +2229,7 @@ type IsZeroer interface {
 
 func isZero(v reflect.Value) bool {
 	kind := v.Kind()
-	if z, ok := v.Interface().(IsZeroer); ok {
+	if z, ok := zeroer(v); ok {
 		if (kind == reflect.Ptr || kind == reflect.Interface) && v.IsNil() {
 			return true
 		}
@@ -465,6 +2267,38 @@ func isZero(v reflect.Value) bool {
 	return false
 }
 
+// isZeroValue reports whether v is the zero value of its type, or
+// zero according to its IsZero method if it has one.
+func isZeroValue(v reflect.Value) bool {
+	kind := v.Kind()
+	if (kind == reflect.Ptr || kind == reflect.Interface) && v.IsNil() {
+		return true
+	}
+	if z, ok := zeroer(v); ok {
+		return z.IsZero()
+	}
+	return v.IsZero()
+}
+
+// zeroer returns v as an IsZeroer if it implements the interface,
+// or a pointer to a copy of v if only its pointer type does.
+func zeroer(v reflect.Value) (IsZeroer, bool) {
+	if z, ok := v.Interface().(IsZeroer); ok {
+		return z, true
+	}
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface || !reflect.PtrTo(v.Type()).Implements(isZeroerType) {
+		return nil, false
+	}
+	if !v.CanAddr() {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		v = p.Elem()
+	}
+	return v.Addr().Interface().(IsZeroer), true
+}
+
+var isZeroerType = reflect.TypeOf((*IsZeroer)(nil)).Elem()
+
 // FutureLineWrap globally disables line wrapping when encoding long strings.
 // This is a temporary and thus deprecated method introduced to faciliate
 // migration towards v3, which offers more control of line lengths on
@@ -27,6 +27,10 @@ const (
 	yaml_UTF8_ENCODING    // The default UTF-8 encoding.
 	yaml_UTF16LE_ENCODING // The UTF-16-LE encoding with BOM.
 	yaml_UTF16BE_ENCODING // The UTF-16-BE encoding with BOM.
+
+	// Not in original libyaml.
+	yaml_UTF32LE_ENCODING // The UTF-32-LE encoding.
+	yaml_UTF32BE_ENCODING // The UTF-32-BE encoding.
 )
 
 type yaml_break_t int
@@ -62,6 +66,7 @@ type yaml_mark_t struct {
 	index  int // The position index.
 	line   int // The position line.
 	column int // The position column.
+	offset int // The position offset in the input, in bytes.
 }
 
 // Node Styles
@@ -297,6 +302,9 @@ type yaml_event_t struct {
 
 	// The style (for yaml_SCALAR_EVENT, yaml_SEQUENCE_START_EVENT, yaml_MAPPING_START_EVENT).
 	style yaml_style_t
+
+	// The comment written on the lines before a block mapping key (for yaml_SCALAR_EVENT).
+	head_comment []byte
 }
 
 func (e *yaml_event_t) scalar_style() yaml_scalar_style_t     { return yaml_scalar_style_t(e.style) }
@@ -319,6 +327,9 @@ const (
 	// Not in original libyaml.
 	yaml_BINARY_TAG = "tag:yaml.org,2002:binary"
 	yaml_MERGE_TAG  = "tag:yaml.org,2002:merge"
+	yaml_SET_TAG    = "tag:yaml.org,2002:set"
+	yaml_OMAP_TAG   = "tag:yaml.org,2002:omap"
+	yaml_PAIRS_TAG  = "tag:yaml.org,2002:pairs"
 
 	yaml_DEFAULT_SCALAR_TAG   = yaml_STR_TAG // The default scalar tag is !!str.
 	yaml_DEFAULT_SEQUENCE_TAG = yaml_SEQ_TAG // The default sequence tag is !!seq.
@@ -558,10 +569,15 @@ type yaml_parser_t struct {
 	raw_buffer_pos int    // The current position of the buffer.
 
 	encoding yaml_encoding_t // The input encoding.
+	bom      bool            // Whether the input starts with a BOM.
+
+	tab_width int // The width of the tabs accepted in indentation, if any.
 
 	offset int         // The offset of the current position (in bytes).
 	mark   yaml_mark_t // The mark of the current position.
 
+	reader_mark yaml_mark_t // The mark of the next character to decode.
+
 	// Scanner stuff
 
 	stream_start_produced bool // Have we started to scan the input stream?
@@ -673,6 +689,14 @@ type yaml_emitter_t struct {
 	unicode     bool         // Allow unescaped non-ASCII characters?
 	line_break  yaml_break_t // The preferred line break.
 
+	indent_sequences   bool // Indent block sequences that are mapping values?
+	implicit_documents bool // Omit the start marker of documents after the first that allow it?
+	no_final_break     bool // Hold the line break ending a document back until the next one?
+	no_flow_wraps      bool // Never break lines between the items of flow collections?
+	no_flow_folds      bool // Never fold the scalars of flow collections?
+
+	pending_break []byte // The line break held back from the last document.
+
 	state  yaml_emitter_state_t   // The current emitter state.
 	states []yaml_emitter_state_t // The stack of states.
 